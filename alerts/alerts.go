@@ -0,0 +1,214 @@
+//raises and clears alerts about problems the monitoring service notices, and publishes them for other services
+package alerts
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xuther/go-message-router/common"
+	"github.com/xuther/go-message-router/publisher"
+)
+
+//the message header every alert is published under
+const Header = "MonitoringAlert"
+
+//alert types
+const (
+	DeviceOffline = "device-offline"
+	RoomStuckOn   = "room-stuck-on"
+)
+
+//alert severities
+const (
+	Warning  = "warning"
+	Critical = "critical"
+)
+
+//where an alert is in its lifecycle. every transition is published
+const (
+	Raised  = "raised"
+	Updated = "updated"
+	Cleared = "cleared"
+)
+
+//the JSON body of every published alert
+type Alert struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	State    string    `json:"state"`
+	Building string    `json:"building"`
+	Room     string    `json:"room"`
+	Device   string    `json:"device,omitempty"`
+	Message  string    `json:"message"`
+	Raised   time.Time `json:"raised"`
+	Updated  time.Time `json:"updated"`
+}
+
+//alerts are identified by what they're about, so raising the same problem twice updates the first alert
+func ID(alertType, building, room, device string) string {
+	id := alertType + "/" + building + "/" + room
+	if len(device) > 0 {
+		id += "/" + device
+	}
+	return id
+}
+
+//where active alerts are kept, so alerts that stop being true while the service is down can still be cleared
+type AlertStore interface {
+	LoadAlerts() ([]Alert, error)
+	SaveAlert(alert Alert) error
+	DeleteAlert(id string) error
+}
+
+//tracks active alerts and publishes every change to them
+type Manager struct {
+	mutex     sync.RWMutex
+	active    map[string]Alert
+	publisher publisher.Publisher
+	saved     AlertStore
+}
+
+//pub may be nil, in which case alerts are tracked and logged but not published
+func NewManager(pub publisher.Publisher) *Manager {
+	return &Manager{
+		active:    make(map[string]Alert),
+		publisher: pub,
+	}
+}
+
+//loads the alerts that were active when the service last ran, without publishing them again, and saves every change to them from now on
+func (m *Manager) SetAlertStore(store AlertStore) error {
+
+	loaded, err := store.LoadAlerts()
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.saved = store
+	for _, alert := range loaded {
+		m.active[alert.ID] = alert
+	}
+
+	return nil
+}
+
+//raises an alert, or updates it if it's already active and its severity or message changed
+func (m *Manager) Raise(alert Alert) {
+	m.mutex.Lock()
+
+	now := time.Now()
+	alert.ID = ID(alert.Type, alert.Building, alert.Room, alert.Device)
+	alert.Updated = now
+
+	existing, ok := m.active[alert.ID]
+	if ok {
+		if existing.Severity == alert.Severity && existing.Message == alert.Message {
+			m.mutex.Unlock()
+			return
+		}
+		alert.State = Updated
+		alert.Raised = existing.Raised
+	} else {
+		alert.State = Raised
+		alert.Raised = now
+	}
+
+	m.active[alert.ID] = alert
+	m.save(alert)
+	m.mutex.Unlock()
+
+	m.publish(alert)
+}
+
+//clears an active alert. clearing an alert that isn't active does nothing
+func (m *Manager) Clear(id string) {
+	m.mutex.Lock()
+
+	alert, ok := m.active[id]
+	if !ok {
+		m.mutex.Unlock()
+		return
+	}
+	delete(m.active, id)
+
+	alert.State = Cleared
+	alert.Updated = time.Now()
+
+	m.save(alert)
+	m.mutex.Unlock()
+
+	m.publish(alert)
+}
+
+func (m *Manager) IsActive(id string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, ok := m.active[id]
+	return ok
+}
+
+//returns every active alert, oldest first
+func (m *Manager) Active() []Alert {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	toReturn := []Alert{}
+	for _, alert := range m.active {
+		toReturn = append(toReturn, alert)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].Raised.Before(toReturn[j].Raised)
+	})
+	return toReturn
+}
+
+//keeps the store in step with the active alerts. must hold m.mutex, so writes for the same alert land in order
+func (m *Manager) save(alert Alert) {
+
+	if m.saved == nil {
+		return
+	}
+
+	var err error
+	if alert.State == Cleared {
+		err = m.saved.DeleteAlert(alert.ID)
+	} else {
+		err = m.saved.SaveAlert(alert)
+	}
+	if err != nil {
+		log.Printf("Error saving alert %s: %s", alert.ID, err.Error())
+	}
+}
+
+func (m *Manager) publish(alert Alert) {
+
+	log.Printf("Alert %s %s: %s", alert.ID, alert.State, alert.Message)
+
+	if m.publisher == nil {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("Error marshaling alert %s: %s", alert.ID, err.Error())
+		return
+	}
+
+	var message common.Message
+	copy(message.MessageHeader[:], Header)
+	message.MessageBody = body
+
+	err = m.publisher.Write(message)
+	if err != nil {
+		log.Printf("Error publishing alert %s: %s", alert.ID, err.Error())
+	}
+}
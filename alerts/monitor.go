@@ -0,0 +1,218 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//how long a room can stay powered on before it's considered stuck
+var StuckOnAfter = 12 * time.Hour
+
+//how often rooms are checked for being stuck on
+var CheckInterval = 1 * time.Minute
+
+//raises and clears alerts as events come through the pipeline
+type Monitor struct {
+	manager *Manager
+
+	//the pipeline's store stage runs first, so records here are up to date with the event being handled
+	store store.Store
+
+	mutex sync.Mutex
+
+	//when each room we've seen powered on was first seen that way
+	poweredOn map[store.RoomID]time.Time
+}
+
+func NewMonitor(m *Manager, s store.Store) *Monitor {
+	return &Monitor{
+		manager:   m,
+		store:     s,
+		poweredOn: make(map[store.RoomID]time.Time),
+	}
+}
+
+//works out which alerts should be active from the records in the store, so nothing is forgotten across a restart.
+//alerts left active from the last run that are no longer true are cleared
+func (m *Monitor) Seed() error {
+
+	devices, err := store.ListDevices(m.store, "", "")
+	if err != nil {
+		return err
+	}
+
+	rooms, err := store.ListRooms(m.store, "")
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	stillTrue := make(map[string]bool)
+
+	for _, device := range devices {
+		if !device.Offline() {
+			continue
+		}
+
+		id := ID(DeviceOffline, device.Building, device.Room, device.Device)
+		stillTrue[id] = true
+
+		if m.manager.IsActive(id) {
+			continue
+		}
+		m.manager.Raise(Alert{
+			Type:     DeviceOffline,
+			Severity: Critical,
+			Building: device.Building,
+			Room:     device.Room,
+			Device:   device.Device,
+			Message:  fmt.Sprintf("%s (minion %s) was last seen at %s", device.Device, device.Minion, device.LastSeen.Format(time.RFC3339)),
+		})
+	}
+
+	for _, record := range rooms {
+		if !strings.EqualFold(record.Room.Power, "on") {
+			continue
+		}
+
+		room := store.RoomID{Building: record.Room.Building, Room: record.Room.Room}
+		since := poweredOnSince(m.store, record)
+		m.poweredOn[room] = since
+
+		//the next check raises it if it isn't already
+		if now.Sub(since) >= StuckOnAfter {
+			stillTrue[ID(RoomStuckOn, room.Building, room.Room, "")] = true
+		}
+	}
+
+	for _, alert := range m.manager.Active() {
+		if !stillTrue[alert.ID] {
+			m.manager.Clear(alert.ID)
+		}
+	}
+
+	return nil
+}
+
+//when a powered on room was turned on, going by its history. if the history has been purged, the last time the record changed is as close as we can get
+func poweredOnSince(s store.Store, record store.RoomRecord) time.Time {
+
+	history, err := store.GetHistory(s, record.Room.Building, record.Room.Room, "", time.Time{}, time.Now())
+	if err != nil {
+		log.Printf("Error getting history for %s %s: %s", record.Room.Building, record.Room.Room, err.Error())
+		return record.Updated
+	}
+
+	since := record.Updated
+	for _, change := range history {
+		if len(change.Device) == 0 && change.Key == pipeline.KeyPower && strings.EqualFold(change.New, "on") {
+			since = change.Time
+		}
+	}
+	return since
+}
+
+//the pipeline stage
+func (m *Monitor) Handle(event pipeline.Event) error {
+
+	room := store.RoomID{Building: event.Building, Room: event.Room}
+	deviceID := ID(DeviceOffline, event.Building, event.Room, event.Device)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch {
+	//a device is only offline once salt knows its minion, which may arrive after it's reported down
+	case (event.Key == pipeline.KeyOnline || event.Key == pipeline.KeyMinion) && len(event.Device) > 0:
+		device, err := store.GetDevice(m.store, event.Building, event.Room, event.Device)
+		if err != nil {
+			return err
+		}
+
+		if !device.Offline() {
+			m.manager.Clear(deviceID)
+			break
+		}
+		if m.manager.IsActive(deviceID) {
+			break
+		}
+
+		m.manager.Raise(Alert{
+			Type:     DeviceOffline,
+			Severity: Critical,
+			Building: event.Building,
+			Room:     event.Room,
+			Device:   event.Device,
+			Message:  fmt.Sprintf("%s (minion %s) went offline at %s", event.Device, device.Minion, event.Timestamp.Format(time.RFC3339)),
+		})
+
+	case event.Key == pipeline.KeyPower && len(event.Device) == 0:
+		if strings.EqualFold(event.Value, "on") {
+			if _, ok := m.poweredOn[room]; !ok {
+				m.poweredOn[room] = event.Timestamp
+			}
+			break
+		}
+
+		delete(m.poweredOn, room)
+		m.manager.Clear(ID(RoomStuckOn, event.Building, event.Room, ""))
+
+	case event.Key == pipeline.KeyInventory && event.Value == store.DeviceRemoved:
+		m.manager.Clear(deviceID)
+
+	case event.Key == pipeline.KeyInventory && event.Value == store.RoomRemoved:
+		delete(m.poweredOn, room)
+		m.manager.Clear(ID(RoomStuckOn, event.Building, event.Room, ""))
+	}
+
+	return nil
+}
+
+//checks for rooms stuck on every CheckInterval until ctx is canceled
+func (m *Monitor) Run(ctx context.Context) {
+
+	log.Printf("Checking for rooms stuck on every %s...", CheckInterval)
+
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Stopping alert monitor")
+			return
+		case <-ticker.C:
+			m.checkStuckOn(time.Now())
+		}
+	}
+}
+
+func (m *Monitor) checkStuckOn(now time.Time) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for room, since := range m.poweredOn {
+		if now.Sub(since) < StuckOnAfter {
+			continue
+		}
+
+		m.manager.Raise(Alert{
+			Type:     RoomStuckOn,
+			Severity: Warning,
+			Building: room.Building,
+			Room:     room.Room,
+			Message:  fmt.Sprintf("%s %s has been powered on since %s", room.Building, room.Room, since.Format(time.RFC3339)),
+		})
+	}
+}
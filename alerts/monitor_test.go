@@ -0,0 +1,177 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//stores every event and then hands it to the monitor, like the pipeline does
+func handle(t *testing.T, s store.Store, m *Monitor, events ...pipeline.Event) {
+	for _, event := range events {
+		err := store.Apply(s, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.Handle(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func event(device, key, value string) pipeline.Event {
+	return pipeline.Event{
+		Source:    pipeline.SourceSalt,
+		Timestamp: time.Now(),
+		Building:  "ITB",
+		Room:      "1101",
+		Device:    device,
+		Key:       key,
+		Value:     value,
+	}
+}
+
+var offlineID = ID(DeviceOffline, "ITB", "1101", "CP1")
+var stuckID = ID(RoomStuckOn, "ITB", "1101", "")
+
+func TestRaiseAndClear(t *testing.T) {
+	s := store.NewMemoryStore()
+	manager := NewManager(nil)
+	manager.SetAlertStore(Saved(s))
+
+	alert := Alert{Type: DeviceOffline, Severity: Critical, Building: "ITB", Room: "1101", Device: "CP1", Message: "down"}
+	manager.Raise(alert)
+	manager.Raise(alert)
+
+	active := manager.Active()
+	if len(active) != 1 || active[0].ID != offlineID || active[0].State != Raised {
+		t.Fatalf("got active alerts %+v, want one raised %s", active, offlineID)
+	}
+
+	//a new message updates the alert without moving when it was raised
+	raised := active[0].Raised
+	alert.Message = "still down"
+	manager.Raise(alert)
+	active = manager.Active()
+	if len(active) != 1 || active[0].State != Updated || !active[0].Raised.Equal(raised) {
+		t.Errorf("got %+v, want the alert updated", active)
+	}
+
+	saved, _ := Saved(s).LoadAlerts()
+	if len(saved) != 1 || saved[0].Message != "still down" {
+		t.Errorf("got saved alerts %+v, want the updated alert", saved)
+	}
+
+	manager.Clear(offlineID)
+	if manager.IsActive(offlineID) {
+		t.Errorf("alert is still active after being cleared")
+	}
+	saved, _ = Saved(s).LoadAlerts()
+	if len(saved) != 0 {
+		t.Errorf("got saved alerts %+v after clearing, want none", saved)
+	}
+}
+
+func TestOfflineNeedsMinion(t *testing.T) {
+	s := store.NewMemoryStore()
+	manager := NewManager(nil)
+	m := NewMonitor(manager, s)
+
+	//salt doesn't manage a device it hasn't named a minion for, so it isn't offline
+	handle(t, s, m, event("CP1", pipeline.KeyOnline, "false"))
+	if manager.IsActive(offlineID) {
+		t.Fatalf("a device without a minion shouldn't be alerted on")
+	}
+
+	//until its minion turns up
+	handle(t, s, m, event("CP1", pipeline.KeyMinion, "ITB-1101-CP1"))
+	if !manager.IsActive(offlineID) {
+		t.Fatalf("a device with a minion that's offline should be alerted on")
+	}
+
+	handle(t, s, m, event("CP1", pipeline.KeyOnline, "true"))
+	if manager.IsActive(offlineID) {
+		t.Errorf("the alert should clear once the device is back")
+	}
+}
+
+func TestSeed(t *testing.T) {
+	after := StuckOnAfter
+	StuckOnAfter = 50 * time.Millisecond
+	defer func() { StuckOnAfter = after }()
+
+	s := store.NewMemoryStore()
+
+	//what the last run saw: CP1 offline, CP2 offline, and the room powered on
+	last := NewMonitor(NewManager(nil), s)
+	last.manager.SetAlertStore(Saved(s))
+	handle(t, s, last,
+		event("CP1", pipeline.KeyMinion, "ITB-1101-CP1"),
+		event("CP1", pipeline.KeyOnline, "false"),
+		event("CP2", pipeline.KeyMinion, "ITB-1101-CP2"),
+		event("CP2", pipeline.KeyOnline, "false"),
+	)
+	poweredOn := time.Now()
+	handle(t, s, last, event("", pipeline.KeyPower, "on"))
+
+	//CP2 came back while we were down, without us handling it
+	store.Apply(s, event("CP2", pipeline.KeyOnline, "true"))
+
+	time.Sleep(StuckOnAfter)
+
+	manager := NewManager(nil)
+	err := manager.SetAlertStore(Saved(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMonitor(manager, s)
+	err = m.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !manager.IsActive(offlineID) {
+		t.Errorf("CP1 is still offline and should be alerted on")
+	}
+	if manager.IsActive(ID(DeviceOffline, "ITB", "1101", "CP2")) {
+		t.Errorf("CP2 came back and its alert should be cleared")
+	}
+
+	//the room has been on since before the restart, not since Seed
+	since := m.poweredOn[store.RoomID{Building: "ITB", Room: "1101"}]
+	if since.Before(poweredOn) || since.After(poweredOn.Add(StuckOnAfter)) {
+		t.Errorf("room was seeded as powered on at %s, want about %s", since, poweredOn)
+	}
+
+	m.checkStuckOn(time.Now())
+	if !manager.IsActive(stuckID) {
+		t.Errorf("a room on since before the restart should be stuck on")
+	}
+}
+
+func TestSeedClearsStuckOn(t *testing.T) {
+	s := store.NewMemoryStore()
+
+	//an alert left from the last run for a room that's since been turned off
+	last := NewManager(nil)
+	last.SetAlertStore(Saved(s))
+	last.Raise(Alert{Type: RoomStuckOn, Severity: Warning, Building: "ITB", Room: "1101", Message: "on"})
+	store.Apply(s, event("", pipeline.KeyPower, "standby"))
+
+	manager := NewManager(nil)
+	manager.SetAlertStore(Saved(s))
+	if !manager.IsActive(stuckID) {
+		t.Fatalf("the saved alert should be loaded")
+	}
+
+	err := NewMonitor(manager, s).Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.IsActive(stuckID) {
+		t.Errorf("a room that's off shouldn't be stuck on")
+	}
+}
@@ -0,0 +1,43 @@
+package alerts
+
+import "github.com/byuoitav/monster-monitoring-service/store"
+
+//keeps active alerts under store.AlertKey
+type savedAlerts struct {
+	s store.Store
+}
+
+func Saved(s store.Store) AlertStore {
+	return savedAlerts{s: s}
+}
+
+func (a savedAlerts) LoadAlerts() ([]Alert, error) {
+
+	var toReturn []Alert
+	err := a.s.Scan(store.Prefix(store.AlertClass), func(key, value []byte) error {
+		var alert Alert
+		err := store.Decode(value, &alert)
+		if err != nil {
+			return err
+		}
+
+		toReturn = append(toReturn, alert)
+		return nil
+	})
+
+	return toReturn, err
+}
+
+func (a savedAlerts) SaveAlert(alert Alert) error {
+
+	value, err := store.Encode(alert)
+	if err != nil {
+		return err
+	}
+
+	return a.s.Put(store.AlertKey(alert.ID), value)
+}
+
+func (a savedAlerts) DeleteAlert(id string) error {
+	return a.s.Delete(store.AlertKey(id))
+}
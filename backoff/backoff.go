@@ -0,0 +1,65 @@
+//jittered exponential backoff for anything that needs to retry a connection
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Backoff struct {
+	Min    time.Duration //delay before the first retry
+	Max    time.Duration //delays never grow past this
+	Factor float64       //how much the delay grows after each attempt
+	Jitter float64       //fraction of each delay that is randomized, between 0 and 1
+
+	mutex   sync.Mutex
+	attempt int
+}
+
+func New(min, max time.Duration) *Backoff {
+	return &Backoff{
+		Min:    min,
+		Max:    max,
+		Factor: 2,
+		Jitter: 0.5,
+	}
+}
+
+//returns how long to wait before the next attempt and counts the attempt
+func (b *Backoff) Next() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delay := float64(b.Min)
+	for i := 0; i < b.attempt && delay < float64(b.Max); i++ {
+		delay *= b.Factor
+	}
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	//spread retries out so a fleet of clients doesn't reconnect in lockstep
+	if b.Jitter > 0 {
+		delay = delay*(1-b.Jitter) + rand.Float64()*delay*b.Jitter
+	}
+
+	b.attempt++
+	return time.Duration(delay)
+}
+
+//number of attempts since the last reset
+func (b *Backoff) Attempt() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.attempt
+}
+
+//called after a successful connection so the next failure starts over at Min
+func (b *Backoff) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.attempt = 0
+}
@@ -0,0 +1,64 @@
+package eventrouter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//a snapshot of the subscription's health
+type SubscriptionStatus struct {
+	Connected     bool      `json:"connected"`
+	Since         time.Time `json:"since"`
+	LastConnected time.Time `json:"lastConnected,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	Reconnects    int       `json:"reconnects"`
+}
+
+var status SubscriptionStatus
+var statusMutex sync.RWMutex
+
+//returns the current state of the event router subscription
+func Status() SubscriptionStatus {
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+
+	return status
+}
+
+//for the readiness check: fails unless we're subscribed to the event router
+func Ready() (time.Time, error) {
+	current := Status()
+	if current.Connected {
+		return time.Time{}, nil
+	}
+
+	err := "not subscribed to the event router"
+	if len(current.LastError) > 0 {
+		err += ": " + current.LastError
+	}
+	return current.LastConnected, errors.New(err)
+}
+
+func setConnected(connected bool) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	if status.Connected == connected && !status.Since.IsZero() {
+		return
+	}
+
+	status.Connected = connected
+	status.Since = time.Now()
+	if connected {
+		status.LastConnected = status.Since
+	}
+}
+
+func setError(err error) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	status.LastError = err.Error()
+	status.Reconnects++
+}
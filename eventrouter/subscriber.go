@@ -0,0 +1,173 @@
+//subscribes to the event router that room control processors publish to
+package eventrouter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
+	"github.com/byuoitav/monster-monitoring-service/backoff"
+	"github.com/byuoitav/monster-monitoring-service/supervisor"
+	"github.com/xuther/go-message-router/common"
+)
+
+//message headers we pass along. everything else the router sends is dropped
+var Filters = []string{eventinfrastructure.APISuccess, eventinfrastructure.APIError}
+
+//bounds on how long to wait between reconnect attempts
+var MinBackoff = 1 * time.Second
+var MaxBackoff = 2 * time.Minute
+
+//messages bigger than this are treated as a corrupt stream
+var MaxMessageSize = 1 << 20
+
+//keeps a subscription to the router at EVENT_ROUTER_ADDRESS (host:port) open until ctx is canceled, reconnecting whenever it drops.
+//anything that speaks the go-message-router publisher protocol can stand in for the router.
+//returns an error only if reading the connection panicked, so it can be restarted from scratch
+func Listen(ctx context.Context, events chan eventinfrastructure.Event) error {
+
+	address := os.Getenv("EVENT_ROUTER_ADDRESS")
+	if len(address) == 0 {
+		log.Printf("EVENT_ROUTER_ADDRESS is not set. Not subscribing to the event router")
+		return nil
+	}
+
+	if filters := os.Getenv("EVENT_ROUTER_FILTERS"); len(filters) > 0 {
+		Filters = strings.Split(filters, ",")
+	}
+
+	log.Printf("Subscribing to the event router at %s for %v...", address, Filters)
+
+	retry := backoff.New(MinBackoff, MaxBackoff)
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			log.Printf("Connected to the event router")
+			setConnected(true)
+			retry.Reset()
+
+			err = read(ctx, conn, events)
+			if err == nil {
+				log.Printf("Shutting down. Closed connection to the event router")
+				setConnected(false)
+				return nil
+			}
+			if _, ok := err.(*supervisor.PanicError); ok {
+				setConnected(false)
+				setError(err)
+				return err
+			}
+		}
+
+		setConnected(false)
+		setError(err)
+
+		wait := retry.Next()
+		log.Printf("Lost connection to the event router: %s. Reconnecting in %s (attempt %d)...", err.Error(), wait, retry.Attempt())
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Abandoning event router reconnect")
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+//reads events off of an open connection. returns nil if ctx was canceled, otherwise the reason the connection stopped
+func read(ctx context.Context, conn net.Conn, events chan eventinfrastructure.Event) error {
+
+	defer conn.Close()
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- supervisor.Recover(func() error {
+			return listenRouter(bufio.NewReader(conn), events, ctx.Done())
+		})
+	}()
+
+	//closing the connection unblocks the reader
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+func listenRouter(reader *bufio.Reader, events chan eventinfrastructure.Event, stop <-chan struct{}) error {
+
+	for {
+		message, err := readMessage(reader)
+		if err == io.EOF {
+			return fmt.Errorf("the event router closed the connection")
+		} else if err != nil {
+			return err
+		}
+
+		header := string(bytes.TrimRight(message.MessageHeader[:], "\x00"))
+		if !wanted(header) {
+			continue
+		}
+
+		var event eventinfrastructure.Event
+		err = json.Unmarshal(message.MessageBody, &event)
+		if err != nil {
+			log.Printf("Error unmarshalling %s event: %s", header, err.Error())
+			continue
+		}
+
+		select {
+		case events <- event:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+//messages are a 24 byte header, a little endian uint32 body length, then the body
+func readMessage(reader io.Reader) (common.Message, error) {
+
+	var message common.Message
+
+	_, err := io.ReadFull(reader, message.MessageHeader[:])
+	if err != nil {
+		return message, err
+	}
+
+	var length uint32
+	err = binary.Read(reader, binary.LittleEndian, &length)
+	if err != nil {
+		return message, err
+	}
+
+	if int(length) > MaxMessageSize {
+		return message, fmt.Errorf("message of %d bytes is too big", length)
+	}
+
+	message.MessageBody = make([]byte, length)
+	_, err = io.ReadFull(reader, message.MessageBody)
+	return message, err
+}
+
+func wanted(header string) bool {
+	for _, filter := range Filters {
+		if strings.TrimSpace(filter) == header {
+			return true
+		}
+	}
+	return false
+}
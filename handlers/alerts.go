@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/alerts"
+	"github.com/labstack/echo"
+)
+
+//lists every active alert
+func GetAlerts(m *alerts.Manager) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		return context.JSON(http.StatusOK, m.Active())
+	}
+}
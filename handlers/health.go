@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/readiness"
+	"github.com/labstack/echo"
+)
+
+//200 with every readiness check if they all pass, 503 with them otherwise
+func Ready(context echo.Context) error {
+
+	ready, checks := readiness.Ready()
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	return context.JSON(status, map[string]interface{}{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
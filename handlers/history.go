@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/labstack/echo"
+)
+
+//returns a room's state changes between the from and to query parameters (RFC 3339), defaulting to the last day
+func GetRoomHistory(s store.Store) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		building := context.Param("building")
+		room := context.Param("room")
+
+		to := time.Now()
+		if len(context.QueryParam("to")) > 0 {
+			parsed, err := time.Parse(time.RFC3339, context.QueryParam("to"))
+			if err != nil {
+				return context.JSON(http.StatusBadRequest, "Invalid to: "+err.Error())
+			}
+			to = parsed
+		}
+
+		from := to.Add(-24 * time.Hour)
+		if len(context.QueryParam("from")) > 0 {
+			parsed, err := time.Parse(time.RFC3339, context.QueryParam("from"))
+			if err != nil {
+				return context.JSON(http.StatusBadRequest, "Invalid from: "+err.Error())
+			}
+			from = parsed
+		}
+
+		if from.After(to) {
+			return context.JSON(http.StatusBadRequest, "from must be before to")
+		}
+
+		history, err := store.GetHistory(s, building, room, context.QueryParam("device"), from, to)
+		if err != nil {
+			log.Printf("Error getting history for room: %s in building: %s: %s", room, building, err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, history)
+	}
+}
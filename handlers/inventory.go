@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/labstack/echo"
+)
+
+//returns inventory changes since the since query parameter (RFC 3339), defaulting to the last 30 days
+func GetInventoryChanges(s store.Store) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		since := time.Now().Add(-30 * 24 * time.Hour)
+		if len(context.QueryParam("since")) > 0 {
+			parsed, err := time.Parse(time.RFC3339, context.QueryParam("since"))
+			if err != nil {
+				return context.JSON(http.StatusBadRequest, "Invalid since: "+err.Error())
+			}
+			since = parsed
+		}
+
+		changes, err := store.GetChangelog(s, since)
+		if err != nil {
+			log.Printf("Error reading inventory changelog: %s", err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, changes)
+	}
+}
+
+//compares the store against the inventory right now
+func SyncInventory(s store.Store, p inventory.Provider, sink pipeline.Sink) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		changes, err := store.SyncInventory(s, p, sink)
+		if err != nil {
+			log.Printf("Error syncing inventory: %s", err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, changes)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/metrics"
+	"github.com/labstack/echo"
+)
+
+var requestLatency = metrics.NewHistogram("monster_http_request_seconds", "How long API requests take, by route, method and status code.", nil, "route", "method", "code")
+
+//times every request. streaming routes are timed until the stream ends
+func Instrument(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		start := time.Now()
+		err := next(context)
+
+		//errors returned up the chain haven't been written yet
+		code := context.Response().Status
+		if httpError, ok := err.(*echo.HTTPError); ok {
+			code = httpError.Code
+		}
+
+		requestLatency.Since(start, context.Path(), context.Request().Method, strconv.Itoa(code))
+		return err
+	}
+}
+
+//every metric, in the Prometheus text format
+func Metrics(context echo.Context) error {
+
+	context.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4")
+	context.Response().WriteHeader(http.StatusOK)
+	metrics.Write(context.Response())
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/minions"
+	"github.com/labstack/echo"
+)
+
+//shows where a minion would be placed. looking a minion up doesn't add it to the unassigned list
+func ResolveMinion(context echo.Context) error {
+
+	minion := context.Param("minion")
+
+	location, ok := minions.Lookup(minion)
+	if !ok {
+		return context.JSON(http.StatusNotFound, "Minion "+minion+" is not assigned to a room")
+	}
+
+	return context.JSON(http.StatusOK, location)
+}
+
+func GetUnassignedMinions(context echo.Context) error {
+	return context.JSON(http.StatusOK, minions.ListUnassigned())
+}
+
+func GetMinionOverrides(context echo.Context) error {
+	return context.JSON(http.StatusOK, minions.Overrides())
+}
+
+func SetMinionOverride(context echo.Context) error {
+
+	var location inventory.Location
+	err := context.Bind(&location)
+	if err != nil {
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if len(location.Building) == 0 || len(location.Room) == 0 || len(location.Device) == 0 {
+		return context.JSON(http.StatusBadRequest, "building, room and device are all required")
+	}
+
+	err = minions.SetOverride(context.Param("minion"), location)
+	if err != nil {
+		log.Printf("Error saving override for minion %s: %s", context.Param("minion"), err.Error())
+		return context.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return context.JSON(http.StatusOK, location)
+}
+
+func RemoveMinionOverride(context echo.Context) error {
+
+	err := minions.RemoveOverride(context.Param("minion"))
+	if err != nil {
+		log.Printf("Error removing override for minion %s: %s", context.Param("minion"), err.Error())
+		return context.JSON(http.StatusInternalServerError, err.Error())
+	}
+
+	return context.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/labstack/echo"
+)
+
+//polls a single room right now and corrects any drift
+func ReconcileRoom(s store.Store, sink pipeline.Sink) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		report, err := store.ReconcileRoom(context.Request().Context(), s, sink, context.Param("building"), context.Param("room"))
+		if err != nil {
+			return context.JSON(http.StatusBadGateway, report)
+		}
+
+		return context.JSON(http.StatusOK, report)
+	}
+}
+
+//polls every stored room in a building right now and corrects any drift
+func ReconcileBuilding(s store.Store, sink pipeline.Sink) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		building := context.Param("building")
+
+		reports, err := store.ReconcileBuilding(context.Request().Context(), s, sink, building)
+		if err != nil {
+			log.Printf("Error reconciling building %s: %s", building, err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, reports)
+	}
+}
@@ -1,7 +1,28 @@
 package handlers
 
-import "github.com/labstack/echo"
+import (
+	"log"
+	"net/http"
 
-func ViewRoom(context echo.Context) error {
-	return nil
+	"github.com/byuoitav/monster-monitoring-service/helpers"
+	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/labstack/echo"
+)
+
+func ViewRoom(s store.Store) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		building := context.Param("building")
+		room := context.Param("room")
+
+		status, err := helpers.QueryRoomStatus(s, building, room)
+		if err == store.ErrNotFound {
+			return context.JSON(http.StatusNotFound, "Room "+room+" in building "+building+" not found")
+		} else if err != nil {
+			log.Printf("Error querying room: %s in building: %s: %s", room, building, err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, status)
+	}
 }
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/helpers"
+	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/labstack/echo"
+)
+
+//lists every building we have rooms for
+func ListBuildings(s store.Store) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		buildings, err := helpers.ListBuildings(s)
+		if err != nil {
+			log.Printf("Error listing buildings: %s", err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, buildings)
+	}
+}
+
+//lists rooms, in one building if the path names one. filter with power, input, muted, offline and stale_for; page with sort, offset and limit
+func ListRooms(s store.Store) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		query := helpers.RoomQuery{
+			Building: context.Param("building"),
+			Power:    context.QueryParam("power"),
+			Input:    context.QueryParam("input"),
+			Sort:     context.QueryParam("sort"),
+		}
+
+		var err error
+		query.Muted, err = boolParam(context, "muted")
+		if err != nil {
+			return context.JSON(http.StatusBadRequest, err.Error())
+		}
+		query.Offline, err = boolParam(context, "offline")
+		if err != nil {
+			return context.JSON(http.StatusBadRequest, err.Error())
+		}
+
+		if value := context.QueryParam("stale_for"); len(value) > 0 {
+			query.StaleFor, err = time.ParseDuration(value)
+			if err != nil {
+				return context.JSON(http.StatusBadRequest, "Invalid stale_for: "+err.Error())
+			}
+		}
+		if value := context.QueryParam("offset"); len(value) > 0 {
+			query.Offset, err = strconv.Atoi(value)
+			if err != nil || query.Offset < 0 {
+				return context.JSON(http.StatusBadRequest, "Invalid offset: "+value)
+			}
+		}
+		if value := context.QueryParam("limit"); len(value) > 0 {
+			query.Limit, err = strconv.Atoi(value)
+			if err != nil || query.Limit < 1 {
+				return context.JSON(http.StatusBadRequest, "Invalid limit: "+value)
+			}
+		}
+
+		page, err := helpers.ListRooms(s, query)
+		if err == helpers.ErrUnknownSort {
+			return context.JSON(http.StatusBadRequest, "Invalid sort: "+query.Sort)
+		} else if err != nil {
+			log.Printf("Error listing rooms: %s", err.Error())
+			return context.JSON(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.JSON(http.StatusOK, page)
+	}
+}
+
+//nil if the parameter wasn't given
+func boolParam(context echo.Context, name string) (*bool, error) {
+
+	value := context.QueryParam(name)
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("Invalid " + name + ": " + value)
+	}
+	return &parsed, nil
+}
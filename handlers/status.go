@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/eventrouter"
+	"github.com/byuoitav/monster-monitoring-service/salt"
+	"github.com/byuoitav/monster-monitoring-service/supervisor"
+	"github.com/labstack/echo"
+)
+
+//reports whether the salt event stream is up
+func SaltStatus(context echo.Context) error {
+	return context.JSON(http.StatusOK, salt.Status())
+}
+
+//reports whether we're subscribed to the event router
+func EventRouterStatus(context echo.Context) error {
+	return context.JSON(http.StatusOK, eventrouter.Status())
+}
+
+//reports each worker's state and how often it's been restarted
+func WorkerStatus(s *supervisor.Supervisor) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		return context.JSON(http.StatusOK, s.Status())
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/byuoitav/monster-monitoring-service/stream"
+	"github.com/labstack/echo"
+)
+
+//streams a snapshot and then every state change over a WebSocket. ?subscribe=building/room/device patterns pick what's streamed
+func StreamWebSocket(h *stream.Hub) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		err := onlyParams(context, "subscribe")
+		if err != nil {
+			return context.JSON(http.StatusBadRequest, "Invalid query: "+err.Error())
+		}
+
+		filter, err := stream.ParseFilter(context.QueryParams()["subscribe"])
+		if err != nil {
+			return context.JSON(http.StatusBadRequest, "Invalid subscribe pattern: "+err.Error())
+		}
+
+		err = stream.ServeWebSocket(h, filter, context.Response().Writer(), context.Request())
+		if err != nil {
+			log.Printf("Error opening WebSocket: %s", err.Error())
+		}
+
+		return nil
+	}
+}
+
+//streams every state change as server-sent events, filtered by the building, room and device query parameters (glob patterns).
+//clients that reconnect with Last-Event-ID are sent what they missed
+func StreamEvents(h *stream.Hub) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		err := onlyParams(context, "building", "room", "device", "lastEventId")
+		if err != nil {
+			return context.JSON(http.StatusBadRequest, "Invalid query: "+err.Error())
+		}
+
+		pattern := stream.Pattern{"*", "*", "*"}
+		for i, param := range []string{"building", "room", "device"} {
+			value := context.QueryParam(param)
+			if len(value) == 0 {
+				continue
+			}
+			if _, err := stream.ParsePattern(value); err != nil {
+				return context.JSON(http.StatusBadRequest, "Invalid "+param+" pattern: "+err.Error())
+			}
+			pattern[i] = value
+		}
+
+		lastEventID := context.Request().Header.Get("Last-Event-ID")
+		if len(lastEventID) == 0 {
+			lastEventID = context.QueryParam("lastEventId")
+		}
+
+		err = stream.ServeEvents(h, stream.Filter{pattern}, lastEventID, context.Response(), context.Request())
+		if err != nil {
+			log.Printf("Error streaming events: %s", err.Error())
+		}
+
+		return nil
+	}
+}
+
+//streams only filter by where a change happened, so the /rooms filters (power, offline and the rest) are turned away rather than silently ignored
+func onlyParams(context echo.Context, allowed ...string) error {
+
+	for param := range context.QueryParams() {
+		known := false
+		for _, name := range allowed {
+			if param == name {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unsupported query parameter %s. streams can only be filtered by %s", param, strings.Join(allowed, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/summary"
+	"github.com/labstack/echo"
+)
+
+//returns fleet-wide and per-building counts of rooms powered on, displays blanked, devices offline, active alerts and stale rooms
+func GetSummary(t *summary.Tracker) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		return context.JSON(http.StatusOK, t.Rollup())
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/labstack/echo"
+)
+
+//answers 503 until the startup sync has polled every room, so nobody mistakes a half-filled store for the truth
+func RequireSync(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(context echo.Context) error {
+
+		progress := store.Progress()
+		if !progress.Complete {
+			return context.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+				"status":   "warming up",
+				"progress": progress,
+			})
+		}
+
+		return next(context)
+	}
+}
+
+//reports how far along the startup sync is
+func SyncStatus(context echo.Context) error {
+	return context.JSON(http.StatusOK, store.Progress())
+}
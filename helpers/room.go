@@ -1,13 +1,42 @@
 package helpers
 
-import "github.com/byuoitav/av-api/base"
+import (
+	"encoding/json"
+	"time"
 
-//queries the data store and returns a PublicRom
-func QueryRoomStatus(building string, room string) (base.PublicRoom, error) {
-	return base.PublicRoom{}, nil
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//a PublicRoom along with when it was last updated and where the data came from
+type RoomStatus struct {
+	base.PublicRoom
+	LastUpdated time.Time `json:"lastUpdated"`
+	Source      string    `json:"source"`
+}
+
+//queries the data store and returns a PublicRoom
+func QueryRoomStatus(s store.Store, building string, room string) (RoomStatus, error) {
+
+	record, err := store.GetRoom(s, building, room)
+	if err != nil {
+		return RoomStatus{}, err
+	}
+
+	return RoomStatus{
+		PublicRoom:  record.Room,
+		LastUpdated: record.Updated,
+		Source:      record.Source,
+	}, nil
 }
 
 //queries the data store and dumps room info
-func GetRoomInfo(building string, room string) ([]byte, error) {
-	return []byte{}, nil
+func GetRoomInfo(s store.Store, building string, room string) ([]byte, error) {
+
+	record, err := store.GetRoom(s, building, room)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(record)
 }
@@ -0,0 +1,218 @@
+package helpers
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//how many rooms a page holds unless asked for fewer or more, and the most it can hold
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+//how rooms can be sorted. prefix with - to reverse
+var roomSorts = map[string]func(a, b RoomStatus) bool{
+	"building": func(a, b RoomStatus) bool {
+		if a.Building != b.Building {
+			return a.Building < b.Building
+		}
+		return a.Room < b.Room
+	},
+	"room": func(a, b RoomStatus) bool {
+		if a.Room != b.Room {
+			return a.Room < b.Room
+		}
+		return a.Building < b.Building
+	},
+	"updated": func(a, b RoomStatus) bool {
+		return a.LastUpdated.Before(b.LastUpdated)
+	},
+	"power": func(a, b RoomStatus) bool {
+		return a.Power < b.Power
+	},
+}
+
+var ErrUnknownSort = errors.New("unknown sort")
+
+//which rooms to list and how. zero values don't filter
+type RoomQuery struct {
+	Building string
+
+	Power    string        //matched case-insensitively against the room's power
+	Input    string        //matched against the room's video input or any display's input
+	Muted    *bool         //the room, or any of its audio devices, is muted
+	Offline  *bool         //any of the room's salt managed devices is offline
+	StaleFor time.Duration //the room hasn't been updated in at least this long
+
+	Sort   string //one of building (the default), room, updated or power, optionally prefixed with -
+	Offset int
+	Limit  int
+}
+
+type RoomPage struct {
+	Total  int          `json:"total"`
+	Offset int          `json:"offset"`
+	Limit  int          `json:"limit"`
+	Rooms  []RoomStatus `json:"rooms"`
+}
+
+//one building and how many rooms we have for it
+type BuildingSummary struct {
+	Building string `json:"building"`
+	Rooms    int    `json:"rooms"`
+}
+
+//every building with stored rooms, by name
+func ListBuildings(s store.Store) ([]BuildingSummary, error) {
+
+	rooms, err := store.ListRooms(s, "")
+	if err != nil {
+		return nil, err
+	}
+
+	//rooms come back in key order, so each building's rooms are together
+	toReturn := []BuildingSummary{}
+	for _, room := range rooms {
+		last := len(toReturn) - 1
+		if last >= 0 && toReturn[last].Building == room.Room.Building {
+			toReturn[last].Rooms++
+			continue
+		}
+		toReturn = append(toReturn, BuildingSummary{Building: room.Room.Building, Rooms: 1})
+	}
+
+	return toReturn, nil
+}
+
+//returns one page of the rooms that match the query
+func ListRooms(s store.Store, query RoomQuery) (RoomPage, error) {
+
+	page := RoomPage{Offset: query.Offset, Limit: query.Limit, Rooms: []RoomStatus{}}
+
+	sortName := strings.TrimPrefix(query.Sort, "-")
+	if len(sortName) == 0 {
+		sortName = "building"
+	}
+	less, ok := roomSorts[sortName]
+	if !ok {
+		return page, ErrUnknownSort
+	}
+
+	if page.Limit <= 0 {
+		page.Limit = DefaultLimit
+	}
+	if page.Limit > MaxLimit {
+		page.Limit = MaxLimit
+	}
+
+	records, err := store.ListRooms(s, query.Building)
+	if err != nil {
+		return page, err
+	}
+
+	var offline map[store.RoomID]bool
+	if query.Offline != nil {
+		offline, err = offlineRooms(s, query.Building)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	now := time.Now()
+	var matched []RoomStatus
+	for _, record := range records {
+		room := record.Room
+
+		if len(query.Power) > 0 && !strings.EqualFold(room.Power, query.Power) {
+			continue
+		}
+		if len(query.Input) > 0 && !hasInput(record, query.Input) {
+			continue
+		}
+		if query.Muted != nil && isMuted(record) != *query.Muted {
+			continue
+		}
+		if query.Offline != nil && offline[store.RoomID{Building: room.Building, Room: room.Room}] != *query.Offline {
+			continue
+		}
+		if query.StaleFor > 0 && now.Sub(record.Updated) < query.StaleFor {
+			continue
+		}
+
+		matched = append(matched, RoomStatus{
+			PublicRoom:  room,
+			LastUpdated: record.Updated,
+			Source:      record.Source,
+		})
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if strings.HasPrefix(query.Sort, "-") {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	page.Total = len(matched)
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+	if page.Offset < len(matched) {
+		end := page.Offset + page.Limit
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Rooms = append(page.Rooms, matched[page.Offset:end]...)
+	}
+
+	return page, nil
+}
+
+func hasInput(record store.RoomRecord, input string) bool {
+
+	if record.Room.CurrentVideoInput == input {
+		return true
+	}
+	for _, display := range record.Room.Displays {
+		if display.Input == input {
+			return true
+		}
+	}
+	return false
+}
+
+func isMuted(record store.RoomRecord) bool {
+
+	if record.Room.Muted != nil && *record.Room.Muted {
+		return true
+	}
+	for _, audio := range record.Room.AudioDevices {
+		if audio.Muted != nil && *audio.Muted {
+			return true
+		}
+	}
+	return false
+}
+
+//rooms with at least one offline device
+func offlineRooms(s store.Store, building string) (map[store.RoomID]bool, error) {
+
+	devices, err := store.ListDevices(s, building, "")
+	if err != nil {
+		return nil, err
+	}
+
+	offline := make(map[store.RoomID]bool)
+	for _, device := range devices {
+		if device.Offline() {
+			offline[store.RoomID{Building: device.Building, Room: device.Room}] = true
+		}
+	}
+
+	return offline, nil
+}
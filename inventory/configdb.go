@@ -0,0 +1,54 @@
+package inventory
+
+import "github.com/byuoitav/av-api/dbo"
+
+//reads the inventory from the configuration database at CONFIGURATION_DATABASE_ADDRESS
+type configDB struct{}
+
+func NewConfigDB() Provider {
+	return configDB{}
+}
+
+func (configDB) Buildings() ([]string, error) {
+	buildings, err := dbo.GetBuildings()
+	if err != nil {
+		return nil, err
+	}
+
+	var toReturn []string
+	for _, building := range buildings {
+		toReturn = append(toReturn, building.Name)
+	}
+	return toReturn, nil
+}
+
+func (configDB) Rooms(building string) ([]string, error) {
+	rooms, err := dbo.GetRoomsByBuilding(building)
+	if err != nil {
+		return nil, err
+	}
+
+	var toReturn []string
+	for _, room := range rooms {
+		toReturn = append(toReturn, room.Name)
+	}
+	return toReturn, nil
+}
+
+func (configDB) Devices(building, room string) ([]Device, error) {
+	devices, err := dbo.GetDevicesByRoom(building, room)
+	if err != nil {
+		return nil, err
+	}
+
+	var toReturn []Device
+	for _, device := range devices {
+		toReturn = append(toReturn, Device{Name: device.Name, Address: device.Address})
+	}
+	return toReturn, nil
+}
+
+//the configuration database has no minion mappings; minions are matched by device address instead
+func (configDB) Minions() (map[string]Location, error) {
+	return map[string]Location{}, nil
+}
@@ -0,0 +1,119 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/byuoitav/av-api/base"
+)
+
+//the layout of an inventory file. see inventory.example.json
+type File struct {
+	Buildings []FileBuilding      `json:"buildings"`
+	Minions   map[string]Location `json:"minions,omitempty"`
+}
+
+type FileBuilding struct {
+	Name  string     `json:"name"`
+	Rooms []FileRoom `json:"rooms"`
+}
+
+type FileRoom struct {
+	Name    string   `json:"name"`
+	Devices []Device `json:"devices"`
+
+	//what RoomStatus reports for the room. defaults to an empty room
+	State *base.PublicRoom `json:"state,omitempty"`
+}
+
+//serves the inventory, and room status, from a JSON file so the service can run without any external services
+type fileProvider struct {
+	buildings map[string]map[string]FileRoom
+	minions   map[string]Location
+}
+
+func LoadFile(path string) (Provider, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	err = json.Unmarshal(b, &file)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing inventory file %s: %s", path, err.Error())
+	}
+
+	provider := &fileProvider{
+		buildings: make(map[string]map[string]FileRoom),
+		minions:   file.Minions,
+	}
+	if provider.minions == nil {
+		provider.minions = make(map[string]Location)
+	}
+
+	for _, building := range file.Buildings {
+		if provider.buildings[building.Name] == nil {
+			provider.buildings[building.Name] = make(map[string]FileRoom)
+		}
+		for _, room := range building.Rooms {
+			provider.buildings[building.Name][room.Name] = room
+		}
+	}
+
+	return provider, nil
+}
+
+func (f *fileProvider) Buildings() ([]string, error) {
+	var toReturn []string
+	for building := range f.buildings {
+		toReturn = append(toReturn, building)
+	}
+	sort.Strings(toReturn)
+	return toReturn, nil
+}
+
+func (f *fileProvider) Rooms(building string) ([]string, error) {
+	rooms, ok := f.buildings[building]
+	if !ok {
+		return nil, fmt.Errorf("building %s is not in the inventory file", building)
+	}
+
+	var toReturn []string
+	for room := range rooms {
+		toReturn = append(toReturn, room)
+	}
+	sort.Strings(toReturn)
+	return toReturn, nil
+}
+
+func (f *fileProvider) Devices(building, room string) ([]Device, error) {
+	r, ok := f.buildings[building][room]
+	if !ok {
+		return nil, fmt.Errorf("room %s in building %s is not in the inventory file", room, building)
+	}
+	return r.Devices, nil
+}
+
+func (f *fileProvider) Minions() (map[string]Location, error) {
+	return f.minions, nil
+}
+
+func (f *fileProvider) RoomStatus(building, room string) (base.PublicRoom, error) {
+	r, ok := f.buildings[building][room]
+	if !ok {
+		return base.PublicRoom{}, fmt.Errorf("room %s in building %s is not in the inventory file", room, building)
+	}
+
+	status := base.PublicRoom{}
+	if r.State != nil {
+		status = *r.State
+	}
+	status.Building = building
+	status.Room = room
+
+	return status, nil
+}
@@ -0,0 +1,30 @@
+//where the list of buildings, rooms and devices comes from
+package inventory
+
+import "github.com/byuoitav/av-api/base"
+
+type Device struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+}
+
+//where a minion lives
+type Location struct {
+	Building string `json:"building"`
+	Room     string `json:"room"`
+	Device   string `json:"device"`
+}
+
+type Provider interface {
+	Buildings() ([]string, error)
+	Rooms(building string) ([]string, error)
+	Devices(building, room string) ([]Device, error)
+
+	//explicit minion to device mappings, for minions whose names don't follow the convention
+	Minions() (map[string]Location, error)
+}
+
+//implemented by providers that can also answer for a room's status, so the av-api isn't needed
+type StatusProvider interface {
+	RoomStatus(building, room string) (base.PublicRoom, error)
+}
@@ -0,0 +1,295 @@
+//a small registry of counters, gauges and histograms, written out in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//latency buckets, in seconds, for histograms that don't need their own
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registered = make(map[string]metric)
+	order      []string
+	mutex      sync.Mutex
+)
+
+//every metric is registered once, when it's created. registering the same name twice is a programming error
+func register(name string, m metric) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := registered[name]; ok {
+		panic("metric " + name + " registered twice")
+	}
+	registered[name] = m
+	order = append(order, name)
+}
+
+//writes every registered metric, by name
+func Write(w io.Writer) {
+	mutex.Lock()
+	names := append([]string{}, order...)
+	mutex.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		mutex.Lock()
+		m := registered[name]
+		mutex.Unlock()
+
+		m.write(w)
+	}
+}
+
+//the values of one metric, keyed by label values
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mutex  sync.Mutex
+	values map[string][]string //encoded label values to the values themselves
+}
+
+func (f *family) init(name, help, kind string, labels []string) {
+	f.name = name
+	f.help = help
+	f.kind = kind
+	f.labels = labels
+	f.values = make(map[string][]string)
+
+	//a metric without labels has one series, and it's written out even before it's touched
+	if len(labels) == 0 {
+		f.series(nil)
+	}
+}
+
+//must hold f.mutex. returns the key the series is stored under
+func (f *family) series(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s wants %d labels, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	if _, ok := f.values[key]; !ok {
+		f.values[key] = values
+	}
+	return key
+}
+
+//must hold f.mutex. label values sorted so output is stable
+func (f *family) keys() []string {
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+//label values can hold anything but these
+var escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+//formats labels as {a="1",b="2"}, with extra appended after the family's own
+func (f *family) format(values []string, extra ...string) string {
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, label+"=\""+escape.Replace(values[i])+"\"")
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"=\""+escape.Replace(extra[i+1])+"\"")
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+//only ever goes up
+type Counter struct {
+	family
+	counts map[string]float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{counts: make(map[string]float64)}
+	c.init(name, help, "counter", labels)
+	register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *Counter) Add(v float64, labels ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counts[c.series(labels)] += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.header(w)
+	for _, key := range c.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.format(c.values[key]), formatFloat(c.counts[key]))
+	}
+}
+
+//goes up and down. a gauge made with NewGaugeFunc reads its value when written instead
+type Gauge struct {
+	family
+	gauges map[string]float64
+	read   func() float64
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{gauges: make(map[string]float64)}
+	g.init(name, help, "gauge", labels)
+	register(name, g)
+	return g
+}
+
+func NewGaugeFunc(name, help string, read func() float64) *Gauge {
+	g := &Gauge{gauges: make(map[string]float64), read: read}
+	g.init(name, help, "gauge", nil)
+	register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.gauges[g.series(labels)] = v
+}
+
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.gauges[g.series(labels)] += v
+}
+
+func (g *Gauge) write(w io.Writer) {
+	if g.read != nil {
+		g.Set(g.read())
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.header(w)
+	for _, key := range g.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.format(g.values[key]), formatFloat(g.gauges[key]))
+	}
+}
+
+//counts observations into cumulative buckets
+type Histogram struct {
+	family
+	buckets  []float64
+	observed map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 //one per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+//nil buckets means DefaultBuckets
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	h := &Histogram{
+		buckets:  append([]float64{}, buckets...),
+		observed: make(map[string]*histogramSeries),
+	}
+	h.init(name, help, "histogram", labels)
+	sort.Float64s(h.buckets)
+
+	for key := range h.values {
+		h.observed[key] = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+	}
+
+	register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := h.series(labels)
+	s, ok := h.observed[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.observed[key] = s
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+//observes how long it's been since start, in seconds
+func (h *Histogram) Since(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.header(w)
+	for _, key := range h.keys() {
+		values := h.values[key]
+		s := h.observed[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.format(values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.format(values), s.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
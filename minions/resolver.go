@@ -0,0 +1,323 @@
+//figures out which building, room and device a salt minion belongs to
+package minions
+
+import (
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+)
+
+//a minion we've heard from but couldn't place
+type Unassigned struct {
+	Minion    string    `json:"minion"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+//where overrides set through the API are kept, so they survive a restart
+type OverrideStore interface {
+	LoadOverrides() (map[string]inventory.Location, error)
+	SaveOverride(minion string, location inventory.Location) error
+	DeleteOverride(minion string) error
+}
+
+//how long the device index built from the inventory is trusted before it's rebuilt
+var IndexTTL = 15 * time.Minute
+
+var mutex sync.RWMutex
+var overrides = make(map[string]inventory.Location) //set through the API
+var mappings = make(map[string]inventory.Location)  //explicit mappings from the inventory
+var unassigned = make(map[string]*Unassigned)
+
+var saved OverrideStore
+
+var source inventory.Provider
+var sourceGeneration int //bumped every time source changes
+var index map[string]inventory.Location
+var indexBuilt time.Time
+var indexing bool //a rebuild is running
+
+//sets where minions are looked up when their names don't follow the convention, and loads the provider's explicit mappings as overrides
+func SetInventory(p inventory.Provider) error {
+
+	found, err := p.Minions()
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	source = p
+	sourceGeneration++
+	index = nil
+	rebuildIndex()
+
+	mappings = make(map[string]inventory.Location, len(found))
+	for minion, location := range found {
+		mappings[normalize(minion)] = location
+	}
+
+	return nil
+}
+
+//loads the overrides kept in store and saves every change to them there from now on
+func SetOverrideStore(store OverrideStore) error {
+
+	loaded, err := store.LoadOverrides()
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	saved = store
+	for minion, location := range loaded {
+		overrides[normalize(minion)] = location
+	}
+
+	log.Printf("Loaded %d minion overrides", len(loaded))
+	return nil
+}
+
+//places a minion like Lookup does, and keeps track of minions that can't be placed
+func Resolve(minion string) (inventory.Location, bool) {
+
+	id := normalize(minion)
+
+	location, ok := Lookup(minion)
+	if ok {
+		forget(id)
+		return location, true
+	}
+
+	remember(id)
+	return inventory.Location{}, false
+}
+
+//places a minion, in order: manual overrides, mappings from the inventory, the BLDG-ROOM-DEVICE hostname convention, then device addresses in the inventory
+func Lookup(minion string) (inventory.Location, bool) {
+
+	id := normalize(minion)
+
+	mutex.RLock()
+	location, ok := overrides[id]
+	if !ok {
+		location, ok = mappings[id]
+	}
+	mutex.RUnlock()
+	if ok {
+		return location, true
+	}
+
+	location, ok = parseHostname(id)
+	if ok {
+		return location, true
+	}
+
+	return lookup(id)
+}
+
+//pins a minion to a location regardless of what its name says
+func SetOverride(minion string, location inventory.Location) error {
+	id := normalize(minion)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if saved != nil {
+		err := saved.SaveOverride(id, location)
+		if err != nil {
+			return err
+		}
+	}
+
+	overrides[id] = location
+	delete(unassigned, id)
+	return nil
+}
+
+func RemoveOverride(minion string) error {
+	id := normalize(minion)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if saved != nil {
+		err := saved.DeleteOverride(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(overrides, id)
+	return nil
+}
+
+//the inventory's mappings, with overrides set through the API in their place where both exist
+func Overrides() map[string]inventory.Location {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	toReturn := make(map[string]inventory.Location, len(mappings)+len(overrides))
+	for minion, location := range mappings {
+		toReturn[minion] = location
+	}
+	for minion, location := range overrides {
+		toReturn[minion] = location
+	}
+	return toReturn
+}
+
+//lists minions that couldn't be placed, sorted by ID
+func ListUnassigned() []Unassigned {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	toReturn := []Unassigned{}
+	for _, minion := range unassigned {
+		toReturn = append(toReturn, *minion)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].Minion < toReturn[j].Minion
+	})
+	return toReturn
+}
+
+//minion IDs are hostnames, which may or may not be fully qualified. device addresses may also be IPs, which are kept whole
+func normalize(minion string) string {
+	minion = strings.TrimSpace(minion)
+	if net.ParseIP(minion) != nil {
+		return strings.ToUpper(minion)
+	}
+	return strings.ToUpper(strings.SplitN(minion, ".", 2)[0])
+}
+
+func parseHostname(id string) (inventory.Location, bool) {
+	parts := strings.Split(id, "-")
+	if len(parts) != 3 {
+		return inventory.Location{}, false
+	}
+
+	for _, part := range parts {
+		if len(part) == 0 {
+			return inventory.Location{}, false
+		}
+	}
+
+	return inventory.Location{Building: parts[0], Room: parts[1], Device: parts[2]}, true
+}
+
+//looks id up in the index as it stands. a stale index is rebuilt in the background, since this is called for every salt event
+func lookup(id string) (inventory.Location, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if source != nil && time.Since(indexBuilt) > IndexTTL {
+		rebuildIndex()
+	}
+
+	location, ok := index[id]
+	return location, ok
+}
+
+//starts building a new index from the inventory and swaps it in when it's done. must hold mutex
+func rebuildIndex() {
+
+	if indexing || source == nil {
+		return
+	}
+	indexing = true
+
+	//don't hammer the database if it's down
+	indexBuilt = time.Now()
+
+	go func(p inventory.Provider, generation int) {
+		built, err := buildIndex(p)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		indexing = false
+
+		//the inventory was swapped out while we were building, so start over with the new one
+		if generation != sourceGeneration {
+			rebuildIndex()
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error building minion index from the inventory: %s", err.Error())
+			return
+		}
+		index = built
+	}(source, sourceGeneration)
+}
+
+//maps every device's address and name in the inventory to where it lives. a building or room that can't be read is skipped
+func buildIndex(p inventory.Provider) (map[string]inventory.Location, error) {
+
+	log.Printf("Building minion index from the inventory...")
+
+	built := make(map[string]inventory.Location)
+
+	buildings, err := p.Buildings()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, building := range buildings {
+		rooms, err := p.Rooms(building)
+		if err != nil {
+			log.Printf("Error getting rooms in %s for the minion index: %s", building, err.Error())
+			continue
+		}
+
+		for _, room := range rooms {
+			devices, err := p.Devices(building, room)
+			if err != nil {
+				log.Printf("Error getting devices in %s %s for the minion index: %s", building, room, err.Error())
+				continue
+			}
+
+			for _, device := range devices {
+				location := inventory.Location{Building: building, Room: room, Device: device.Name}
+				if len(device.Address) > 0 {
+					built[normalize(device.Address)] = location
+				}
+				built[normalize(building+"-"+room+"-"+device.Name)] = location
+			}
+		}
+	}
+
+	log.Printf("Indexed %d minion names", len(built))
+	return built, nil
+}
+
+func remember(id string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	now := time.Now()
+	minion, ok := unassigned[id]
+	if !ok {
+		log.Printf("Minion %s doesn't map to a room. Adding to the unassigned list", id)
+		minion = &Unassigned{Minion: id, FirstSeen: now}
+		unassigned[id] = minion
+	}
+	minion.LastSeen = now
+}
+
+func forget(id string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(unassigned, id)
+}
@@ -0,0 +1,243 @@
+package minions
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+)
+
+//an inventory of building -> room -> devices. rooms listed in broken fail to load
+type fakeInventory struct {
+	buildings map[string]map[string][]inventory.Device
+	minions   map[string]inventory.Location
+	broken    map[string]bool
+
+	mutex sync.Mutex
+	calls int //calls to Devices
+}
+
+func (f *fakeInventory) Buildings() ([]string, error) {
+	var toReturn []string
+	for building := range f.buildings {
+		toReturn = append(toReturn, building)
+	}
+	return toReturn, nil
+}
+
+func (f *fakeInventory) Rooms(building string) ([]string, error) {
+	var toReturn []string
+	for room := range f.buildings[building] {
+		toReturn = append(toReturn, room)
+	}
+	return toReturn, nil
+}
+
+func (f *fakeInventory) Devices(building, room string) ([]inventory.Device, error) {
+	f.mutex.Lock()
+	f.calls++
+	f.mutex.Unlock()
+
+	if f.broken[building+"-"+room] {
+		return nil, errors.New("room unavailable")
+	}
+	return f.buildings[building][room], nil
+}
+
+func (f *fakeInventory) Minions() (map[string]inventory.Location, error) {
+	return f.minions, nil
+}
+
+//starts every test from an empty resolver
+func reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	overrides = make(map[string]inventory.Location)
+	mappings = make(map[string]inventory.Location)
+	unassigned = make(map[string]*Unassigned)
+	saved = nil
+	source = nil
+	index = nil
+	indexBuilt = time.Time{}
+}
+
+//waits for the index being built in the background to be swapped in
+func waitForIndex(t *testing.T) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mutex.RLock()
+		done := index != nil && !indexing
+		mutex.RUnlock()
+		if done {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("the minion index was never built")
+}
+
+func TestLookupHostname(t *testing.T) {
+	reset()
+
+	location, ok := Lookup("itb-1101-cp1.byu.edu")
+	if !ok {
+		t.Fatalf("ITB-1101-CP1 wasn't placed")
+	}
+	if location != (inventory.Location{Building: "ITB", Room: "1101", Device: "CP1"}) {
+		t.Errorf("got %+v", location)
+	}
+
+	if _, ok := Lookup("ITB--CP1"); ok {
+		t.Errorf("a hostname with an empty part shouldn't be placed")
+	}
+}
+
+func TestLookupOrder(t *testing.T) {
+	reset()
+
+	mapped := inventory.Location{Building: "JFSB", Room: "B203", Device: "CP1"}
+	SetInventory(&fakeInventory{minions: map[string]inventory.Location{"ITB-1101-CP1": mapped}})
+	waitForIndex(t)
+
+	//a mapping from the inventory beats the hostname
+	if location, _ := Lookup("ITB-1101-CP1"); location != mapped {
+		t.Errorf("got %+v, want the mapping %+v", location, mapped)
+	}
+
+	//and an override beats the mapping
+	pinned := inventory.Location{Building: "TNRB", Room: "170", Device: "CP2"}
+	if err := SetOverride("itb-1101-cp1", pinned); err != nil {
+		t.Fatal(err)
+	}
+	if location, _ := Lookup("ITB-1101-CP1"); location != pinned {
+		t.Errorf("got %+v, want the override %+v", location, pinned)
+	}
+
+	if err := RemoveOverride("ITB-1101-CP1"); err != nil {
+		t.Fatal(err)
+	}
+	if location, _ := Lookup("ITB-1101-CP1"); location != mapped {
+		t.Errorf("got %+v after removing the override, want %+v", location, mapped)
+	}
+}
+
+func TestLookupIndex(t *testing.T) {
+	reset()
+
+	p := &fakeInventory{
+		buildings: map[string]map[string][]inventory.Device{
+			"ITB": {
+				"1101": {{Name: "CP1", Address: "10.5.34.12"}, {Name: "D1", Address: "itb1101d1.byu.edu"}},
+				"1108": {{Name: "CP1", Address: "10.5.34.40"}},
+			},
+		},
+		broken: map[string]bool{"ITB-1108": true},
+	}
+	if err := SetInventory(p); err != nil {
+		t.Fatal(err)
+	}
+	waitForIndex(t)
+
+	//IPs are kept whole
+	location, ok := Lookup("10.5.34.12")
+	if !ok || location != (inventory.Location{Building: "ITB", Room: "1101", Device: "CP1"}) {
+		t.Errorf("10.5.34.12 placed at %+v, %v", location, ok)
+	}
+
+	//hostnames are matched without their domain
+	location, ok = Lookup("ITB1101D1")
+	if !ok || location != (inventory.Location{Building: "ITB", Room: "1101", Device: "D1"}) {
+		t.Errorf("ITB1101D1 placed at %+v, %v", location, ok)
+	}
+
+	//a room that failed to load is skipped without losing the rest of the index
+	if _, ok := Lookup("10.5.34.40"); ok {
+		t.Errorf("a device in a room that failed to load shouldn't be placed")
+	}
+}
+
+func TestLookupDoesntWaitOnIndex(t *testing.T) {
+	reset()
+
+	release := make(chan struct{})
+	p := &blockingInventory{fakeInventory: fakeInventory{}, release: release}
+	SetInventory(p)
+
+	looked := make(chan bool, 1)
+	go func() {
+		_, ok := Lookup("10.5.34.12")
+		looked <- ok
+	}()
+
+	select {
+	case ok := <-looked:
+		if ok {
+			t.Errorf("nothing should be placed before the index is built")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Lookup waited on the index being built")
+	}
+
+	close(release)
+	waitForIndex(t)
+}
+
+//an inventory that doesn't list its buildings until release is closed
+type blockingInventory struct {
+	fakeInventory
+	release chan struct{}
+}
+
+func (b *blockingInventory) Buildings() ([]string, error) {
+	<-b.release
+	return b.fakeInventory.Buildings()
+}
+
+func TestIndexTTL(t *testing.T) {
+	reset()
+
+	p := &fakeInventory{
+		buildings: map[string]map[string][]inventory.Device{
+			"ITB": {"1101": {{Name: "CP1", Address: "10.5.34.12"}}},
+		},
+	}
+	SetInventory(p)
+	waitForIndex(t)
+
+	for i := 0; i < 10; i++ {
+		Lookup("10.5.34.12")
+	}
+	p.mutex.Lock()
+	calls := p.calls
+	p.mutex.Unlock()
+	if calls != 1 {
+		t.Errorf("the inventory was read %d times, want once until the index expires", calls)
+	}
+}
+
+func TestResolveTracksUnassigned(t *testing.T) {
+	reset()
+
+	//looking a minion up doesn't keep track of it
+	Lookup("mystery.byu.edu")
+	if len(ListUnassigned()) != 0 {
+		t.Errorf("Lookup shouldn't track unassigned minions")
+	}
+
+	Resolve("mystery.byu.edu")
+	Resolve("MYSTERY")
+	unplaced := ListUnassigned()
+	if len(unplaced) != 1 || unplaced[0].Minion != "MYSTERY" {
+		t.Fatalf("got unassigned %+v, want just MYSTERY", unplaced)
+	}
+
+	//and forgets it once it can be placed
+	SetOverride("mystery", inventory.Location{Building: "ITB", Room: "1101", Device: "CP9"})
+	Resolve("mystery")
+	if len(ListUnassigned()) != 0 {
+		t.Errorf("a minion that's been placed shouldn't be unassigned")
+	}
+}
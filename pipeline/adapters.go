@@ -0,0 +1,232 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
+	"github.com/byuoitav/monster-monitoring-service/minions"
+	"github.com/byuoitav/monster-monitoring-service/salt"
+)
+
+//turns a salt event into events about the devices it mentions. events about minions that can't be placed are dropped
+func FromSalt(event salt.TypedEvent) []Event {
+
+	stamp := event.Stamp()
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	raw, err := json.Marshal(event.Raw())
+	if err != nil {
+		log.Printf("Error marshaling salt event %s: %s", event.Raw().Tag, err.Error())
+	}
+
+	var events []Event
+	device := func(minion string, pairs ...string) {
+		location, ok := minions.Resolve(minion)
+		if !ok {
+			return
+		}
+
+		add := func(key, value string) {
+			events = append(events, Event{
+				Source:    SourceSalt,
+				Timestamp: stamp,
+				Building:  location.Building,
+				Room:      location.Room,
+				Device:    location.Device,
+				Key:       key,
+				Value:     value,
+				Raw:       raw,
+			})
+		}
+
+		add(KeyMinion, minion)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			add(pairs[i], pairs[i+1])
+		}
+	}
+
+	switch e := event.(type) {
+	case salt.MinionStart:
+		device(e.Minion, KeyOnline, "true")
+
+	case salt.Beacon:
+		device(e.Minion, KeyOnline, "true")
+
+	case salt.JobReturn:
+		job, err := json.Marshal(JobResult{
+			JID:      e.JID,
+			Function: e.Function,
+			Success:  e.Success,
+			RetCode:  e.RetCode,
+		})
+		if err != nil {
+			log.Printf("Error marshaling job result %s: %s", e.JID, err.Error())
+			break
+		}
+		device(e.Minion, KeyOnline, "true", KeyJob, string(job))
+
+	case salt.Presence:
+		for _, minion := range append(e.Present, e.New...) {
+			device(minion, KeyOnline, "true")
+		}
+		for _, minion := range e.Lost {
+			device(minion, KeyOnline, "false")
+		}
+	}
+
+	return events
+}
+
+//turns an event router event into a single event, or none if it doesn't say anything
+func FromRouter(event eventinfrastructure.Event) []Event {
+
+	if len(event.Event.EventInfoKey) == 0 {
+		return nil
+	}
+
+	stamp, err := time.Parse(time.RFC3339, event.Timestamp)
+	if err != nil {
+		stamp = time.Now()
+	}
+
+	raw, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling event router event: %s", err.Error())
+	}
+
+	return []Event{{
+		Source:    SourceEventRouter,
+		Timestamp: stamp,
+		Building:  event.Building,
+		Room:      event.Room,
+		Device:    event.Event.Device,
+		Key:       event.Event.EventInfoKey,
+		Value:     event.Event.EventInfoValue,
+		Raw:       raw,
+	}}
+}
+
+//turns a room snapshot into one event per field that has a value. each device's role comes before its other fields
+func FromRoom(room base.PublicRoom, source string) []Event {
+
+	raw, err := json.Marshal(room)
+	if err != nil {
+		log.Printf("Error marshaling room %s %s: %s", room.Building, room.Room, err.Error())
+	}
+
+	now := time.Now()
+
+	var events []Event
+	add := func(device, key, value string) {
+		if len(value) == 0 {
+			return
+		}
+		events = append(events, Event{
+			Source:    source,
+			Timestamp: now,
+			Building:  room.Building,
+			Room:      room.Room,
+			Device:    device,
+			Key:       key,
+			Value:     value,
+			Raw:       raw,
+		})
+	}
+
+	add("", KeyPower, room.Power)
+	add("", KeyInput, room.CurrentVideoInput)
+	add("", KeyAudioInput, room.CurrentAudioInput)
+	add("", KeyBlanked, formatBool(room.Blanked))
+	add("", KeyMuted, formatBool(room.Muted))
+	add("", KeyVolume, formatInt(room.Volume))
+
+	for _, display := range room.Displays {
+		add(display.Name, KeyRole, RoleDisplay)
+		add(display.Name, KeyPower, display.Power)
+		add(display.Name, KeyInput, display.Input)
+		add(display.Name, KeyBlanked, formatBool(display.Blanked))
+	}
+
+	for _, audio := range room.AudioDevices {
+		add(audio.Name, KeyRole, RoleAudio)
+		add(audio.Name, KeyPower, audio.Power)
+		add(audio.Name, KeyInput, audio.Input)
+		add(audio.Name, KeyMuted, formatBool(audio.Muted))
+		add(audio.Name, KeyVolume, formatInt(audio.Volume))
+	}
+
+	return events
+}
+
+//says a room's state was just polled, whether or not anything in it changed
+func Verified(building, room, source string) Event {
+	return Event{
+		Source:    source,
+		Timestamp: time.Now(),
+		Building:  building,
+		Room:      room,
+		Key:       KeyVerified,
+	}
+}
+
+//the events that take after from before: clears for every field before has that after doesn't, and an empty role for
+//every display or audio device after no longer has. FromRoom(after) sets everything else
+func Clears(before, after base.PublicRoom, source string) []Event {
+
+	now := time.Now()
+	set := make(map[[2]string]bool)
+	for _, event := range FromRoom(after, source) {
+		set[[2]string{event.Device, event.Key}] = true
+	}
+
+	var events []Event
+	add := func(device, key string) {
+		events = append(events, Event{
+			Source:    source,
+			Timestamp: now,
+			Building:  after.Building,
+			Room:      after.Room,
+			Device:    device,
+			Key:       key,
+		})
+	}
+
+	//fields first, so the device is empty by the time it's removed
+	var removed []string
+	for _, event := range FromRoom(before, source) {
+		field := [2]string{event.Device, event.Key}
+		switch {
+		case set[field]:
+		case event.Key == KeyRole:
+			removed = append(removed, event.Device)
+		default:
+			add(event.Device, event.Key)
+		}
+	}
+
+	for _, device := range removed {
+		add(device, KeyRole)
+	}
+
+	return events
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func formatInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
@@ -0,0 +1,74 @@
+//normalizes everything the service hears about into one event type and feeds it through storage and alerting
+package pipeline
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//where an event came from
+const (
+	SourceSalt        = "salt"
+	SourceEventRouter = "event-router"
+	SourceAVAPI       = "av-api"
+	SourceReconcile   = "reconcile"
+	SourceInventory   = "inventory"
+)
+
+//Keys with a well known meaning. Room-wide events have no device.
+//
+//	power, input, audioInput, blanked, muted, volume    room or device state, as in base.PublicRoom
+//	role                                               "display" or "audio": what kind of device this is
+//	minion                                             the salt minion ID behind a device
+//	online                                             "true" or "false"
+//	job                                                a JobResult, JSON encoded
+//	verified                                           room-wide, no value: the room was just polled, so what's stored is current
+//	inventory, discrepancy                             notices rather than state: see IsNotice
+//
+//Any other device key is kept as free-form device state. An empty value clears a room field, and an empty role
+//takes the device out of the room. See Clears.
+const (
+	KeyPower       = "power"
+	KeyInput       = "input"
+	KeyAudioInput  = "audioInput"
+	KeyBlanked     = "blanked"
+	KeyMuted       = "muted"
+	KeyVolume      = "volume"
+	KeyRole        = "role"
+	KeyMinion      = "minion"
+	KeyOnline      = "online"
+	KeyJob         = "job"
+	KeyVerified    = "verified"
+	KeyInventory   = "inventory"
+	KeyDiscrepancy = "discrepancy"
+)
+
+//values of KeyRole
+const (
+	RoleDisplay = "display"
+	RoleAudio   = "audio"
+)
+
+type Event struct {
+	Source    string          `json:"source"`
+	Timestamp time.Time       `json:"timestamp"`
+	Building  string          `json:"building"`
+	Room      string          `json:"room"`
+	Device    string          `json:"device,omitempty"`
+	Key       string          `json:"key"`
+	Value     string          `json:"value"`
+	Raw       json.RawMessage `json:"raw,omitempty"`
+}
+
+//the value of a KeyJob event
+type JobResult struct {
+	JID      string `json:"jid"`
+	Function string `json:"function"`
+	Success  bool   `json:"success"`
+	RetCode  int    `json:"retcode"`
+}
+
+//notices report that something happened rather than a new value for a piece of state
+func (e Event) IsNotice() bool {
+	return e.Key == KeyInventory || e.Key == KeyDiscrepancy
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
+	"github.com/byuoitav/monster-monitoring-service/metrics"
+)
+
+var (
+	eventsReceived = metrics.NewCounter("monster_events_received_total", "Events received, by source and class.", "source", "class")
+	eventsDropped  = metrics.NewCounter("monster_events_dropped_total", "Events received that said nothing the service keeps, like events about minions that can't be placed in a room.", "source", "class")
+	eventsFailed   = metrics.NewCounter("monster_events_failed_total", "Events a pipeline stage failed to handle, by source and class.", "source", "class")
+)
+
+//the class of an event router event is its event type
+func routerClass(event eventinfrastructure.Event) string {
+	switch event.Event.Type {
+	case eventinfrastructure.CORESTATE:
+		return "core-state"
+	case eventinfrastructure.DETAILSTATE:
+		return "detail-state"
+	case eventinfrastructure.ERROR:
+		return "error"
+	case eventinfrastructure.USERACTION:
+		return "user-action"
+	case eventinfrastructure.HEALTH:
+		return "health"
+	}
+	return "other"
+}
+
+//the class of a submitted event is whether it's a notice or state
+func submittedClass(event Event) string {
+	if event.IsNotice() {
+		return "notice"
+	}
+	return "state"
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
+	"github.com/byuoitav/monster-monitoring-service/salt"
+)
+
+//how long Run keeps handling what was already submitted once it's told to stop
+var DrainTimeout = 5 * time.Second
+
+//anything that wants to see every event. handlers run one event at a time, in the order they were added
+type Handler interface {
+	Handle(Event) error
+}
+
+type HandlerFunc func(Event) error
+
+func (f HandlerFunc) Handle(e Event) error {
+	return f(e)
+}
+
+//accepts events from code that produces them directly, like room polls
+type Sink interface {
+	Submit(events ...Event)
+}
+
+type Stage struct {
+	Name    string
+	Handler Handler
+
+	//if a required stage fails to handle an event, the stages after it never see that event
+	Required bool
+}
+
+type Pipeline struct {
+	stages    []Stage
+	submitted chan Event
+	stopped   chan struct{} //closed by Stop, so nothing waits on a pipeline that's gone
+	stop      sync.Once
+}
+
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{
+		stages:    stages,
+		submitted: make(chan Event, 1024),
+		stopped:   make(chan struct{}),
+	}
+}
+
+//queues events for the pipeline. blocks if the pipeline is far behind, and drops events once it has stopped
+func (p *Pipeline) Submit(events ...Event) {
+	for _, event := range events {
+		select {
+		case p.submitted <- event:
+		case <-p.stopped:
+			eventsDropped.Inc(event.Source, submittedClass(event))
+		}
+	}
+}
+
+//for after the last Run has returned for good: from then on Submit drops events instead of waiting for them to be taken
+func (p *Pipeline) Stop() {
+	p.stop.Do(func() {
+		close(p.stopped)
+	})
+}
+
+//adapts salt and event router events and passes them, along with submitted events, through every stage until ctx is canceled,
+//then handles whatever is still submitted for up to DrainTimeout. it can be run again after it returns, e.g. after a panic, and picks up whatever was submitted in between
+func (p *Pipeline) Run(ctx context.Context, saltEvents chan salt.SaltEvent, routerEvents chan eventinfrastructure.Event) {
+
+	log.Printf("Running event pipeline...")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Stopping event pipeline")
+			p.drain()
+			return
+		case event := <-saltEvents:
+			typed := salt.Classify(event)
+			p.dispatch(SourceSalt, salt.Class(typed), FromSalt(typed))
+		case event := <-routerEvents:
+			p.dispatch(SourceEventRouter, routerClass(event), FromRouter(event))
+		case event := <-p.submitted:
+			p.dispatch(event.Source, submittedClass(event), []Event{event})
+		}
+	}
+}
+
+//handles submitted events until none are left or DrainTimeout passes
+func (p *Pipeline) drain() {
+
+	deadline := time.After(DrainTimeout)
+
+	for {
+		select {
+		case event := <-p.submitted:
+			p.dispatch(event.Source, submittedClass(event), []Event{event})
+		case <-deadline:
+			log.Printf("Gave up on %d submitted events after %s", len(p.submitted), DrainTimeout)
+			return
+		default:
+			return
+		}
+	}
+}
+
+//runs what one received event became through every stage
+func (p *Pipeline) dispatch(source, class string, events []Event) {
+
+	eventsReceived.Inc(source, class)
+	if len(events) == 0 {
+		eventsDropped.Inc(source, class)
+		return
+	}
+
+	for _, event := range events {
+		for _, stage := range p.stages {
+			err := stage.Handler.Handle(event)
+			if err != nil {
+				eventsFailed.Inc(source, class)
+				log.Printf("Error handling %s event %s/%s/%s %s in %s: %s", event.Source, event.Building, event.Room, event.Device, event.Key, stage.Name, err.Error())
+
+				if stage.Required {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
+	"github.com/byuoitav/monster-monitoring-service/salt"
+)
+
+func TestRunDrainsOnStop(t *testing.T) {
+	handled := 0
+	p := New(Stage{Name: "count", Handler: HandlerFunc(func(Event) error {
+		handled++
+		return nil
+	})})
+
+	for i := 0; i < 100; i++ {
+		p.Submit(Event{Source: SourceAVAPI, Key: KeyPower, Value: "on"})
+	}
+
+	//already canceled, so Run goes straight to draining
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx, make(chan salt.SaltEvent), make(chan eventinfrastructure.Event))
+
+	if handled != 100 {
+		t.Errorf("handled %d submitted events before stopping, want 100", handled)
+	}
+}
+
+func TestRequiredStage(t *testing.T) {
+	var seen []string
+	stage := func(name string, err error, required bool) Stage {
+		return Stage{Name: name, Required: required, Handler: HandlerFunc(func(Event) error {
+			seen = append(seen, name)
+			return err
+		})}
+	}
+
+	//a stage that isn't required doesn't hold the rest up
+	p := New(stage("alerts", errors.New("failed"), false), stage("summary", nil, false))
+	p.dispatch(SourceAVAPI, "state", []Event{{Key: KeyPower}})
+	if len(seen) != 2 {
+		t.Errorf("stages that saw the event: %v, want both", seen)
+	}
+
+	seen = nil
+	p = New(stage("store", errors.New("failed"), true), stage("alerts", nil, false))
+	p.dispatch(SourceAVAPI, "state", []Event{{Key: KeyPower}})
+	if len(seen) != 1 {
+		t.Errorf("stages that saw the event: %v, want only the failed store stage", seen)
+	}
+}
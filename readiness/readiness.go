@@ -0,0 +1,102 @@
+//tracks whether the service is ready to answer requests: connected to its sources, with its store open and its initial sync done
+package readiness
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//how long Ready waits on probes before failing the ones that haven't answered
+var ProbeTimeout = 5 * time.Second
+
+//reports whether a dependency is healthy, and when it last was if the dependency knows. a zero time means it doesn't know
+type Probe func() (time.Time, error)
+
+//the outcome of one probe
+type Check struct {
+	Name        string     `json:"name"`
+	OK          bool       `json:"ok"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type check struct {
+	name        string
+	probe       Probe
+	lastSuccess time.Time
+}
+
+var (
+	checks []*check
+	mutex  sync.Mutex
+)
+
+//adds a probe. the service is only ready while every registered probe passes
+func Register(name string, probe Probe) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	checks = append(checks, &check{name: name, probe: probe})
+}
+
+//runs every probe at once, reporting them in the order they were registered. a probe that takes longer than ProbeTimeout fails,
+//and is left to finish on its own
+func Ready() (bool, []Check) {
+
+	mutex.Lock()
+	registered := append([]*check{}, checks...)
+	mutex.Unlock()
+
+	type outcome struct {
+		lastSuccess time.Time
+		err         error
+	}
+
+	outcomes := make([]chan outcome, len(registered))
+	for i, c := range registered {
+		outcomes[i] = make(chan outcome, 1)
+		go func(c *check, results chan outcome) {
+			lastSuccess, err := c.probe()
+			results <- outcome{lastSuccess: lastSuccess, err: err}
+		}(c, outcomes[i])
+	}
+
+	timeout := time.After(ProbeTimeout)
+
+	ready := true
+	toReturn := []Check{}
+
+	for i, c := range registered {
+		var result outcome
+		select {
+		case result = <-outcomes[i]:
+		case <-timeout:
+			result.err = fmt.Errorf("timed out after %s", ProbeTimeout)
+		}
+
+		if result.err == nil && result.lastSuccess.IsZero() {
+			result.lastSuccess = time.Now()
+		}
+
+		mutex.Lock()
+		//remember successes the dependency itself forgets, e.g. an invalidated token
+		if result.lastSuccess.After(c.lastSuccess) {
+			c.lastSuccess = result.lastSuccess
+		}
+		lastSuccess := c.lastSuccess
+		mutex.Unlock()
+
+		check := Check{Name: c.name, OK: result.err == nil}
+		if !lastSuccess.IsZero() {
+			check.LastSuccess = &lastSuccess
+		}
+		if result.err != nil {
+			check.Error = result.err.Error()
+			ready = false
+		}
+		toReturn = append(toReturn, check)
+	}
+
+	return ready, toReturn
+}
@@ -0,0 +1,103 @@
+package readiness
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+//runs fn with only the probes it registers, restoring the real ones after
+func isolated(fn func()) {
+	mutex.Lock()
+	saved := checks
+	checks = nil
+	mutex.Unlock()
+
+	defer func() {
+		mutex.Lock()
+		checks = saved
+		mutex.Unlock()
+	}()
+
+	fn()
+}
+
+func TestReady(t *testing.T) {
+	isolated(func() {
+		known := time.Now().Add(-time.Minute)
+		failing := true
+
+		Register("ok", func() (time.Time, error) { return known, nil })
+		Register("failing", func() (time.Time, error) {
+			if failing {
+				return time.Time{}, errors.New("down")
+			}
+			return time.Time{}, nil
+		})
+
+		ready, results := Ready()
+		if ready {
+			t.Errorf("ready with a failing probe")
+		}
+		if len(results) != 2 || results[0].Name != "ok" || results[1].Name != "failing" {
+			t.Fatalf("got checks %+v, want them in registration order", results)
+		}
+		if !results[0].OK || !results[0].LastSuccess.Equal(known) {
+			t.Errorf("got %+v, want ok with the probe's own last success", results[0])
+		}
+		if results[1].OK || results[1].Error != "down" || results[1].LastSuccess != nil {
+			t.Errorf("got %+v, want a failure that has never succeeded", results[1])
+		}
+
+		failing = false
+		ready, _ = Ready()
+		if !ready {
+			t.Errorf("not ready once every probe passes")
+		}
+
+		//a failure after a success still reports when it last worked
+		failing = true
+		_, results = Ready()
+		if results[1].LastSuccess == nil {
+			t.Errorf("forgot the last success: %+v", results[1])
+		}
+	})
+}
+
+func TestReadyTimeout(t *testing.T) {
+	timeout := ProbeTimeout
+	ProbeTimeout = 100 * time.Millisecond
+	defer func() { ProbeTimeout = timeout }()
+
+	isolated(func() {
+		release := make(chan struct{})
+		defer close(release)
+
+		Register("stuck", func() (time.Time, error) {
+			<-release
+			return time.Time{}, nil
+		})
+		Register("ok", func() (time.Time, error) { return time.Time{}, nil })
+
+		start := time.Now()
+		ready, results := Ready()
+		if time.Since(start) > time.Second {
+			t.Fatalf("Ready waited %s on a stuck probe", time.Since(start))
+		}
+		if ready || results[0].OK || !results[1].OK {
+			t.Errorf("got %+v, want only the stuck probe to fail", results)
+		}
+
+		//a stuck probe doesn't hold up registering another
+		registered := make(chan bool)
+		go func() {
+			Register("later", func() (time.Time, error) { return time.Time{}, nil })
+			registered <- true
+		}()
+		select {
+		case <-registered:
+		case <-time.After(time.Second):
+			t.Fatalf("Register waited on a stuck probe")
+		}
+	})
+}
@@ -1,43 +1,89 @@
 package salt
 
 import (
-	"bufio"
+	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
-	"sync"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/backoff"
+	"github.com/byuoitav/monster-monitoring-service/supervisor"
 )
 
-func Listen(events chan SaltEvent, done chan bool, signal *sync.WaitGroup) {
+//bounds on how long to wait between reconnect attempts
+var MinBackoff = 1 * time.Second
+var MaxBackoff = 2 * time.Minute
+
+//keeps the salt event stream open until ctx is canceled, reconnecting whenever it drops.
+//returns an error only if reading the stream panicked, so it can be restarted from scratch
+func Listen(ctx context.Context, events chan SaltEvent) error {
+
+	if len(os.Getenv("SALT_MASTER_ADDRESS")) == 0 {
+		log.Printf("SALT_MASTER_ADDRESS is not set. Not listening for salt events")
+		return nil
+	}
 
 	log.Printf("Starting salt routine...")
 
-	var read, listen sync.Once
+	retry := backoff.New(MinBackoff, MaxBackoff)
+
+	//carried across reconnects so we can pick up where the last stream left off
+	var lastEventID string
+	var serverRetry time.Duration
 
 	for {
+		setState(Connecting)
+
+		response, err := connect(ctx, lastEventID)
+		if err == nil {
+			setState(Connected)
+			retry.Reset()
+
+			reader := NewEventReader(response.Body)
+			err = read(ctx, response, reader, events)
+			if err == nil {
+				log.Printf("Shutting down. Closed connection to salt")
+				setState(Disconnected)
+				return nil
+			}
+			if _, ok := err.(*supervisor.PanicError); ok {
+				setState(Disconnected)
+				setError(err)
+				return err
+			}
+
+			lastEventID = reader.LastEventID()
+			if reader.Retry() > 0 {
+				serverRetry = reader.Retry()
+			}
+		}
+
+		setState(Disconnected)
+		setError(err)
+		reconnects.Inc()
+
+		//never come back sooner than the stream asked us to
+		wait := retry.Next()
+		if wait < serverRetry {
+			wait = serverRetry
+		}
+		log.Printf("Lost connection to salt: %s. Reconnecting in %s (attempt %d)...", err.Error(), wait, retry.Attempt())
+
 		select {
-		case <-done:
-			log.Printf("SIGTERM signal detected. Closing connection to salt...")
-			Connection().Response.Body.Close()
-			break
-		default:
-			read.Do(func() {
-				connect()
-			})
-			listen.Do(func() {
-				go listenSalt(events)
-			})
+		case <-ctx.Done():
+			log.Printf("Shutting down. Abandoning salt reconnect")
+			return nil
+		case <-time.After(wait):
 		}
 	}
-	signal.Done()
 }
 
-var reader *bufio.Reader
-
-func connect() {
+func connect(ctx context.Context, lastEventID string) (*http.Response, error) {
 
 	log.Printf("Subscribing to salt...")
 
@@ -46,66 +92,91 @@ func connect() {
 	}
 	client := &http.Client{Transport: transport}
 
-	req, err := http.NewRequest("GET", os.Getenv("SALT_MASTER_ADDRESS")+"/events", nil)
-	if err != nil {
-		log.Printf("Cannot open request %s", err.Error())
-		return
-	}
+	//a rejected token gets one immediate retry with a fresh login
+	for attempt := 0; ; attempt++ {
+
+		token, err := Connection().Token()
+		if err != nil {
+			log.Printf("Error logging into salt: %s", err.Error())
+			return nil, err
+		}
 
-	req.Header.Add("X-Auth-Token", Connection().Token)
+		req, err := http.NewRequest("GET", os.Getenv("SALT_MASTER_ADDRESS")+"/events", nil)
+		if err != nil {
+			log.Printf("Cannot open request %s", err.Error())
+			return nil, err
+		}
 
-	Connection().Response, err = client.Do(req)
-	if err != nil {
-		log.Printf("Error sending Request %s", err.Error())
-		return
-	}
+		req = req.WithContext(ctx)
+		req.Header.Add("X-Auth-Token", token)
+		req.Header.Set("Accept", "text/event-stream")
+		if len(lastEventID) > 0 {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
 
-	reader = bufio.NewReader(Connection().Response.Body)
+		response, err := client.Do(req)
+		if err != nil {
+			log.Printf("Error sending Request %s", err.Error())
+			return nil, err
+		}
+
+		switch response.StatusCode {
+		case http.StatusOK:
+			Connection().Response = response
+			return response, nil
+		case http.StatusUnauthorized, http.StatusForbidden:
+			response.Body.Close()
+			Connection().Invalidate()
+			if attempt == 0 {
+				log.Printf("Salt rejected our token with %s. Logging in again...", response.Status)
+				continue
+			}
+		default:
+			response.Body.Close()
+		}
+
+		return nil, fmt.Errorf("salt responded with %s", response.Status)
+	}
 }
 
-func listenSalt(events chan SaltEvent) {
+//reads events off of an open stream. returns nil if ctx was canceled, otherwise the reason the stream stopped
+func read(ctx context.Context, response *http.Response, reader *EventReader, events chan SaltEvent) error {
 
-	log.Printf("Reading salt events...")
+	defer response.Body.Close()
 
-	for {
-		if reader == nil {
-			log.Printf("Reader not initialized. Waiting for connection...")
-			continue
-		}
+	errs := make(chan error, 1)
 
-		if Connection().Response.Close {
-			log.Printf("Detected closed salt connection. Terminating process...")
-			break
-		}
+	go func() {
+		errs <- supervisor.Recover(func() error {
+			return listenSalt(reader, events, ctx.Done())
+		})
+	}()
 
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			log.Fatal("Error reading event" + err.Error())
-		} else {
-			if strings.Contains(line, "retry") {
-				continue
-			} else if strings.Contains(line, "tag") {
+	//closing the body unblocks the reader
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
 
-				line2, err := reader.ReadString('\n')
-				if err != nil {
-					log.Fatal(err)
-				}
+func listenSalt(reader *EventReader, events chan SaltEvent, stop <-chan struct{}) error {
 
-				if strings.Contains(line2, "data") {
+	log.Printf("Reading salt events...")
 
-					jsonString := line2[5:]
-					var event SaltEvent
+	for {
+		event, err := reader.Read()
+		if err == io.EOF {
+			return errors.New("salt closed the event stream")
+		} else if err != nil {
+			return fmt.Errorf("error reading event: %s", err.Error())
+		}
 
-					err := json.Unmarshal([]byte(jsonString), &event)
-					if err != nil {
-						log.Fatal("Error unmarshalling event" + err.Error())
-					}
-					events <- event
-				}
-			} else if len(line) < 1 {
-				continue
-			}
+		select {
+		case events <- event:
+		case <-stop:
+			return nil
 		}
 	}
-	return
 }
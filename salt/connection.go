@@ -4,17 +4,37 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/backoff"
 )
 
+//how long before the token expires that we log in again. never more than half the token's lifetime
+var RefreshMargin = 5 * time.Minute
+
+//how long a login request can take before it's abandoned
+var LoginTimeout = 30 * time.Second
+
 type SaltConnection struct {
-	Token    string
-	Expires  float64
 	Response *http.Response
+
+	//one login at a time. held across the request to salt, so nothing that only reads the token waits on it
+	loggingIn sync.Mutex
+
+	mutex    sync.Mutex
+	token    string
+	expires  time.Time
+	lifetime time.Duration
+	refresh  *time.Timer
+	retry    *backoff.Backoff //spaces out failed refreshes
 }
 
 type LoginResponse struct {
@@ -37,16 +57,130 @@ var once sync.Once
 
 func Connection() *SaltConnection {
 	once.Do(func() {
-		log.Printf("Logging into salt...")
-		connection = &SaltConnection{}
-		connection.Login()
+		connection = &SaltConnection{retry: backoff.New(MinBackoff, MaxBackoff)}
 	})
 	return connection
 }
 
+//returns a token that is good for at least the refresh margin, logging in again if necessary
+func (sc *SaltConnection) Token() (string, error) {
+
+	token, ok := sc.current()
+	if ok {
+		return token, nil
+	}
+
+	sc.loggingIn.Lock()
+	defer sc.loggingIn.Unlock()
+
+	//someone else may have logged in while we waited
+	token, ok = sc.current()
+	if ok {
+		return token, nil
+	}
+
+	err := sc.login()
+	if err != nil {
+		return "", err
+	}
+
+	token, _ = sc.current()
+	return token, nil
+}
+
+//the token, and whether it's good for at least the refresh margin
+func (sc *SaltConnection) current() (string, bool) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return sc.token, len(sc.token) > 0 && time.Now().Add(sc.margin()).Before(sc.expires)
+}
+
+//when the current token stops working. zero if we aren't logged in
+func (sc *SaltConnection) Expires() time.Time {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return sc.expires
+}
+
+//true if we hold a token that hasn't expired yet
+func (sc *SaltConnection) Valid() bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return len(sc.token) > 0 && time.Now().Before(sc.expires)
+}
+
+//for the readiness check: fails unless we hold an unexpired token
+func TokenReady() (time.Time, error) {
+	if Connection().Valid() {
+		return time.Time{}, nil
+	}
+	return time.Time{}, errors.New("no valid salt token")
+}
+
+//throws away the current token, e.g. after salt rejects it, so the next call to Token logs in again
+func (sc *SaltConnection) Invalidate() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	log.Printf("Invalidating salt token")
+
+	sc.token = ""
+	sc.expires = time.Time{}
+	if sc.refresh != nil {
+		sc.refresh.Stop()
+	}
+}
+
 func (sc *SaltConnection) Login() error {
+	sc.loggingIn.Lock()
+	defer sc.loggingIn.Unlock()
+
+	return sc.login()
+}
+
+//must hold sc.loggingIn. the request is made without sc.mutex, which is only taken to swap the new token in
+func (sc *SaltConnection) login() error {
 	log.Printf("Logging into the salt master")
 
+	lr, err := requestToken()
+	if err != nil {
+		loginFailures.Inc()
+		return err
+	}
+
+	//salt's clock may not match ours, so count the lifetime from now instead of trusting its expiry outright
+	var lifetime time.Duration
+	if lr.Start > 0 && lr.Expire > lr.Start {
+		lifetime = toTime(lr.Expire).Sub(toTime(lr.Start))
+	} else if lr.Expire > 0 {
+		lifetime = time.Until(toTime(lr.Expire))
+	}
+	if lifetime <= 0 {
+		loginFailures.Inc()
+		err = fmt.Errorf("salt login response has no expiry, or one that's already passed: %v", lr.Expire)
+		log.Printf("%s", err.Error())
+		return err
+	}
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.token = lr.Token
+	sc.lifetime = lifetime
+	sc.expires = time.Now().Add(lifetime)
+
+	sc.retry.Reset()
+	sc.scheduleRefresh(time.Until(sc.expires.Add(-sc.margin())))
+
+	log.Printf("Done. Token expires at %s", sc.expires.Format(time.RFC3339))
+	return nil
+}
+
+func requestToken() (LoginResponse, error) {
+
 	values := make(map[string]string)
 	values["username"] = os.Getenv("SALT_EVENT_USERNAME")
 	values["password"] = os.Getenv("SALT_EVENT_PASSWORD")
@@ -57,7 +191,7 @@ func (sc *SaltConnection) Login() error {
 	req, err := http.NewRequest("POST", os.Getenv("SALT_MASTER_ADDRESS")+"/login", bytes.NewBuffer(b))
 	if err != nil {
 		log.Printf("Error building the request: %s", err.Error())
-		return err
+		return LoginResponse{}, err
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
@@ -68,34 +202,91 @@ func (sc *SaltConnection) Login() error {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: tr, Timeout: LoginTimeout}
 
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Error sending the login request: %s", err.Error())
-		return err
+		return LoginResponse{}, err
 	}
+	defer resp.Body.Close()
 
 	log.Printf("Request sent")
 
-	respBody := make(map[string][]LoginResponse)
-
 	b, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Error reading the login response: %s", err.Error())
+		return LoginResponse{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("salt login failed with %s", resp.Status)
+		log.Printf("%s", err.Error())
+		return LoginResponse{}, err
 	}
 
-	log.Printf("Body: %s", b)
+	respBody := make(map[string][]LoginResponse)
+
 	err = json.Unmarshal(b, &respBody)
 	if err != nil {
 		log.Printf("Error unmarshalling login response: %s", err.Error())
+		return LoginResponse{}, err
+	}
+
+	if len(respBody["return"]) == 0 {
+		err = errors.New("salt login response contained no token")
+		log.Printf("%s: %s", err.Error(), b)
+		return LoginResponse{}, err
 	}
 
-	log.Printf("Struct %+v", respBody)
 	lr := respBody["return"][0]
+	if len(lr.Token) == 0 {
+		err = errors.New("salt login response contained an empty token")
+		log.Printf("%s", err.Error())
+		return LoginResponse{}, err
+	}
 
-	sc.Token = lr.Token
-	sc.Expires = lr.Expire
-	log.Printf("Done.")
-	return nil
+	return lr, nil
+}
+
+//salt time, in fractional unix seconds
+func toTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second)))
+}
+
+//how long before expiry the token is refreshed. short lived tokens get half their lifetime so we don't log in continuously
+func (sc *SaltConnection) margin() time.Duration {
+	if sc.lifetime > 0 && sc.lifetime/2 < RefreshMargin {
+		return sc.lifetime / 2
+	}
+	return RefreshMargin
+}
+
+//logs in again after wait so nothing ever tries to use a dead token. failed refreshes are retried with backoff. must hold sc.mutex
+func (sc *SaltConnection) scheduleRefresh(wait time.Duration) {
+	if sc.refresh != nil {
+		sc.refresh.Stop()
+	}
+
+	if wait < MinBackoff {
+		wait = MinBackoff
+	}
+
+	sc.refresh = time.AfterFunc(wait, func() {
+		log.Printf("Salt token is about to expire. Refreshing...")
+
+		sc.loggingIn.Lock()
+		defer sc.loggingIn.Unlock()
+
+		err := sc.login()
+		if err != nil {
+			sc.mutex.Lock()
+			defer sc.mutex.Unlock()
+
+			retry := sc.retry.Next()
+			log.Printf("Error refreshing salt token: %s. Trying again in %s", err.Error(), retry)
+			sc.scheduleRefresh(retry)
+		}
+	})
 }
@@ -0,0 +1,121 @@
+package salt
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/backoff"
+)
+
+func newConnection() *SaltConnection {
+	return &SaltConnection{retry: backoff.New(MinBackoff, MaxBackoff)}
+}
+
+//points SALT_MASTER_ADDRESS at a salt master served by handler until the returned func is called
+func fakeMaster(handler http.HandlerFunc) func() {
+	server := httptest.NewServer(handler)
+
+	address := os.Getenv("SALT_MASTER_ADDRESS")
+	os.Setenv("SALT_MASTER_ADDRESS", server.URL)
+
+	return func() {
+		server.Close()
+		os.Setenv("SALT_MASTER_ADDRESS", address)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	now := float64(time.Now().Unix())
+
+	//an hour ahead of us, with a 12 hour token
+	done := fakeMaster(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"return": [{"token": "abc", "start": %f, "expire": %f}]}`, now+3600, now+3600+12*3600)
+	})
+	defer done()
+
+	sc := newConnection()
+	defer sc.Invalidate()
+
+	token, err := sc.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "abc" {
+		t.Errorf("got token %q, want abc", token)
+	}
+
+	//the lifetime counts from our clock, not salt's
+	if until := time.Until(sc.Expires()); until < 11*time.Hour || until > 12*time.Hour {
+		t.Errorf("token expires in %s, want about 12h", until)
+	}
+}
+
+func TestLoginWithoutExpiry(t *testing.T) {
+	past := float64(time.Now().Add(-time.Hour).Unix())
+
+	for _, body := range []string{
+		`{"return": [{"token": "abc"}]}`,
+		fmt.Sprintf(`{"return": [{"token": "abc", "expire": %f}]}`, past),
+	} {
+		done := fakeMaster(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		})
+
+		sc := newConnection()
+		_, err := sc.Token()
+		if err == nil {
+			t.Errorf("logging in with %s should fail", body)
+		}
+		if sc.Valid() {
+			t.Errorf("logging in with %s left a token", body)
+		}
+
+		sc.Invalidate()
+		done()
+	}
+}
+
+func TestLoginTimeout(t *testing.T) {
+	timeout := LoginTimeout
+	LoginTimeout = 200 * time.Millisecond
+	defer func() { LoginTimeout = timeout }()
+
+	release := make(chan struct{})
+	done := fakeMaster(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer done()
+	defer close(release)
+
+	sc := newConnection()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := sc.Token()
+		errs <- err
+	}()
+
+	//reading the token doesn't wait on a login in progress
+	time.Sleep(50 * time.Millisecond)
+	checked := make(chan bool, 1)
+	go func() { checked <- sc.Valid() }()
+
+	select {
+	case <-checked:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Valid waited on a login")
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("a login that times out should fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("login didn't time out")
+	}
+}
@@ -0,0 +1,215 @@
+package salt
+
+import (
+	"strings"
+	"time"
+)
+
+//implemented by every classified salt event. events with tags we don't recognize come back as a plain SaltEvent
+type TypedEvent interface {
+	Raw() SaltEvent
+	Stamp() time.Time
+}
+
+//salt/minion/<id>/start
+type MinionStart struct {
+	SaltEvent
+	Minion string
+}
+
+//salt/auth
+type Auth struct {
+	SaltEvent
+	Minion string
+	Action string //accept, pend or reject
+	Result bool
+}
+
+//salt/presence/present lists every connected minion, salt/presence/change lists the differences
+type Presence struct {
+	SaltEvent
+	Present []string
+	New     []string
+	Lost    []string
+}
+
+//salt/job/<jid>/new
+type JobNew struct {
+	SaltEvent
+	JID      string
+	Function string
+	Target   string
+	Minions  []string
+	User     string
+	Args     []interface{}
+}
+
+//salt/job/<jid>/ret/<minion>
+type JobReturn struct {
+	SaltEvent
+	JID      string
+	Minion   string
+	Function string
+	Success  bool
+	RetCode  int
+	Return   interface{}
+}
+
+//salt/beacon/<minion>/<beacon>/
+type Beacon struct {
+	SaltEvent
+	Minion  string
+	Beacon  string
+	Payload map[string]interface{}
+}
+
+//the format salt uses for _stamp
+const stampLayout = "2006-01-02T15:04:05.999999"
+
+func (e SaltEvent) Raw() SaltEvent {
+	return e
+}
+
+//when salt generated the event. zero if the event didn't carry a _stamp
+func (e SaltEvent) Stamp() time.Time {
+	stamp, err := time.Parse(stampLayout, getString(e.Data, "_stamp"))
+	if err != nil {
+		return time.Time{}
+	}
+	return stamp
+}
+
+//a short name for what kind of event this is, for metrics
+func Class(event TypedEvent) string {
+	switch event.(type) {
+	case MinionStart:
+		return "minion-start"
+	case Auth:
+		return "auth"
+	case Presence:
+		return "presence"
+	case JobNew:
+		return "job-new"
+	case JobReturn:
+		return "job-return"
+	case Beacon:
+		return "beacon"
+	}
+	return "other"
+}
+
+//turns a raw event into one of the typed events above based on its tag
+func Classify(event SaltEvent) TypedEvent {
+
+	parts := strings.Split(strings.TrimSuffix(event.Tag, "/"), "/")
+
+	if event.Tag == "minion_start" {
+		return MinionStart{SaltEvent: event, Minion: getString(event.Data, "id")}
+	}
+
+	if len(parts) < 2 || parts[0] != "salt" {
+		return event
+	}
+
+	switch parts[1] {
+	case "auth":
+		return Auth{
+			SaltEvent: event,
+			Minion:    getString(event.Data, "id"),
+			Action:    getString(event.Data, "act"),
+			Result:    getBool(event.Data, "result"),
+		}
+
+	case "presence":
+		if len(parts) != 3 || (parts[2] != "present" && parts[2] != "change") {
+			break
+		}
+		return Presence{
+			SaltEvent: event,
+			Present:   getStrings(event.Data, "present"),
+			New:       getStrings(event.Data, "new"),
+			Lost:      getStrings(event.Data, "lost"),
+		}
+
+	case "minion":
+		if len(parts) != 4 || parts[3] != "start" {
+			break
+		}
+		return MinionStart{SaltEvent: event, Minion: parts[2]}
+
+	case "job":
+		if len(parts) == 4 && parts[3] == "new" {
+			return JobNew{
+				SaltEvent: event,
+				JID:       parts[2],
+				Function:  getString(event.Data, "fun"),
+				Target:    getString(event.Data, "tgt"),
+				Minions:   getStrings(event.Data, "minions"),
+				User:      getString(event.Data, "user"),
+				Args:      getSlice(event.Data, "arg"),
+			}
+		}
+		if len(parts) == 5 && parts[3] == "ret" {
+			return JobReturn{
+				SaltEvent: event,
+				JID:       parts[2],
+				Minion:    parts[4],
+				Function:  getString(event.Data, "fun"),
+				Success:   getBool(event.Data, "success"),
+				RetCode:   getInt(event.Data, "retcode"),
+				Return:    event.Data["return"],
+			}
+		}
+
+	case "beacon":
+		if len(parts) < 4 {
+			break
+		}
+
+		//beacons usually nest their payload under "data", but not all of them do
+		payload, ok := event.Data["data"].(map[string]interface{})
+		if !ok {
+			payload = event.Data
+		}
+
+		return Beacon{
+			SaltEvent: event,
+			Minion:    parts[2],
+			Beacon:    strings.Join(parts[3:], "/"),
+			Payload:   payload,
+		}
+	}
+
+	return event
+}
+
+func getString(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return value
+}
+
+func getBool(data map[string]interface{}, key string) bool {
+	value, _ := data[key].(bool)
+	return value
+}
+
+//JSON numbers come through as float64
+func getInt(data map[string]interface{}, key string) int {
+	value, _ := data[key].(float64)
+	return int(value)
+}
+
+func getSlice(data map[string]interface{}, key string) []interface{} {
+	value, _ := data[key].([]interface{})
+	return value
+}
+
+func getStrings(data map[string]interface{}, key string) []string {
+	var toReturn []string
+	for _, value := range getSlice(data, key) {
+		if str, ok := value.(string); ok {
+			toReturn = append(toReturn, str)
+		}
+	}
+	return toReturn
+}
@@ -0,0 +1,8 @@
+package salt
+
+import "github.com/byuoitav/monster-monitoring-service/metrics"
+
+var (
+	reconnects    = metrics.NewCounter("monster_salt_reconnects_total", "Times the salt event stream was lost and reconnected.")
+	loginFailures = metrics.NewCounter("monster_salt_login_failures_total", "Failed logins to the salt master.")
+)
@@ -0,0 +1,51 @@
+package salt
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/sse"
+)
+
+//reads SaltEvents off of a salt-api /events stream
+type EventReader struct {
+	decoder *sse.Decoder
+}
+
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{decoder: sse.NewDecoder(r)}
+}
+
+//blocks until the next salt event arrives. malformed events are logged and skipped
+func (er *EventReader) Read() (SaltEvent, error) {
+	for {
+		raw, err := er.decoder.Decode()
+		if err != nil {
+			return SaltEvent{}, err
+		}
+
+		var event SaltEvent
+		err = json.Unmarshal([]byte(raw.Data), &event)
+		if err != nil {
+			log.Printf("Error unmarshalling event: %s", err.Error())
+			continue
+		}
+
+		if len(event.Tag) == 0 {
+			log.Printf("Skipping salt event without a tag: %s", raw.Data)
+			continue
+		}
+
+		return event, nil
+	}
+}
+
+func (er *EventReader) LastEventID() string {
+	return er.decoder.LastEventID()
+}
+
+func (er *EventReader) Retry() time.Duration {
+	return er.decoder.Retry()
+}
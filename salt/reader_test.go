@@ -0,0 +1,78 @@
+package salt
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventReaderSkipsBadEvents(t *testing.T) {
+	stream := strings.Join([]string{
+		"retry: 400",
+		"",
+		"tag: salt/event/new_client",
+		`data: {"tag": "salt/event/new_client", "data": {"_stamp": "2017-07-20T17:06:40.123456"}}`,
+		"",
+		//no tag
+		`data: {"data": {"id": "ITB-1101-CP1.byu.edu"}}`,
+		"",
+		`data: {"tag": "", "data": {}}`,
+		"",
+		//not JSON at all
+		"data: Minion ITB-1101-CP1.byu.edu started",
+		"",
+		//cut off mid-object
+		`data: {"tag": "salt/auth", "data": {"act": `,
+		"",
+		//the wrong shape
+		`data: ["salt/auth"]`,
+		"",
+		"id: 42",
+		"tag: salt/auth",
+		`data: {"tag": "salt/auth", "data": {"act": "accept", "id": "ITB-1101-CP1.byu.edu", "result": true}}`,
+		"",
+		"",
+	}, "\n")
+
+	reader := NewEventReader(strings.NewReader(stream))
+
+	var tags []string
+	for {
+		event, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		tags = append(tags, event.Tag)
+	}
+
+	want := []string{"salt/event/new_client", "salt/auth"}
+	if strings.Join(tags, ",") != strings.Join(want, ",") {
+		t.Fatalf("got tags %q, want %q", tags, want)
+	}
+
+	if reader.LastEventID() != "42" {
+		t.Errorf("got last event ID %q, want 42", reader.LastEventID())
+	}
+	if reader.Retry() != 400*time.Millisecond {
+		t.Errorf("got retry %s, want 400ms", reader.Retry())
+	}
+}
+
+func TestEventReaderData(t *testing.T) {
+	stream := "tag: salt/job/20170720170650123456/ret/ITB-1101-CP1.byu.edu\n" +
+		`data: {"tag": "salt/job/20170720170650123456/ret/ITB-1101-CP1.byu.edu", "data": {"fun": "test.ping", "jid": "20170720170650123456", "retcode": 0, "return": true, "success": true}}` +
+		"\n\n"
+
+	event, err := NewEventReader(strings.NewReader(stream)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Data["fun"] != "test.ping" || event.Data["success"] != true {
+		t.Errorf("event data wasn't decoded: %v", event.Data)
+	}
+}
@@ -0,0 +1,87 @@
+package salt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Disconnected State = iota
+	Connecting
+	Connected
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+//a snapshot of the event stream's health
+type StreamStatus struct {
+	State         State     `json:"state"`
+	Since         time.Time `json:"since"`
+	LastConnected time.Time `json:"lastConnected,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	Reconnects    int       `json:"reconnects"`
+}
+
+var status StreamStatus
+var statusMutex sync.RWMutex
+
+//returns the current state of the salt event stream
+func Status() StreamStatus {
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+
+	return status
+}
+
+//for the readiness check: fails unless the event stream is connected
+func StreamReady() (time.Time, error) {
+	current := Status()
+	if current.State == Connected {
+		return time.Time{}, nil
+	}
+
+	err := "salt event stream is " + current.State.String()
+	if len(current.LastError) > 0 {
+		err += ": " + current.LastError
+	}
+	return current.LastConnected, errors.New(err)
+}
+
+func setState(state State) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	if status.State == state {
+		return
+	}
+
+	status.State = state
+	status.Since = time.Now()
+	if state == Connected {
+		status.LastConnected = status.Since
+	}
+}
+
+func setError(err error) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	status.LastError = err.Error()
+	status.Reconnects++
+}
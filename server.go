@@ -1,65 +1,309 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"syscall"
+	"time"
 
 	"github.com/byuoitav/authmiddleware"
+	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
+	"github.com/byuoitav/monster-monitoring-service/alerts"
+	"github.com/byuoitav/monster-monitoring-service/eventrouter"
 	"github.com/byuoitav/monster-monitoring-service/handlers"
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/metrics"
+	"github.com/byuoitav/monster-monitoring-service/minions"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/readiness"
 	"github.com/byuoitav/monster-monitoring-service/salt"
 	"github.com/byuoitav/monster-monitoring-service/store"
+	"github.com/byuoitav/monster-monitoring-service/stream"
+	"github.com/byuoitav/monster-monitoring-service/summary"
+	"github.com/byuoitav/monster-monitoring-service/supervisor"
+	"github.com/jessemillar/health"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/xuther/go-message-router/publisher"
 )
 
 func main() {
 
-	store.OnStart()
+	db, err := store.Open(store.DefaultOptions)
+	if err != nil {
+		log.Fatalf("Error opening store in %s: %s", store.DefaultOptions.Dir, err.Error())
+	}
 
-	var control sync.WaitGroup
-	NUM_PROCESSES := 2
+	provider := inventory.NewConfigDB()
+	if path := os.Getenv("INVENTORY_FILE"); len(path) > 0 {
+		log.Printf("Reading inventory from %s...", path)
+		provider, err = inventory.LoadFile(path)
+		if err != nil {
+			log.Fatalf("Error loading inventory file: %s", err.Error())
+		}
+	}
 
-	signals := make(chan os.Signal, 1)
-	timer := make(chan bool, 1)
-	signal.Notify(signals, os.Interrupt)
+	//a provider that knows room status stands in for the av-api
+	if statuses, ok := provider.(inventory.StatusProvider); ok {
+		store.PollRoom = statuses.RoomStatus
+	}
+
+	err = minions.SetInventory(provider)
+	if err != nil {
+		log.Printf("Error loading minion mappings: %s", err.Error())
+	}
+	err = minions.SetOverrideStore(store.MinionOverrides(db))
+	if err != nil {
+		log.Printf("Error loading minion overrides from the store: %s", err.Error())
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL")); err == nil && interval > 0 {
+		store.ReconcileInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("INVENTORY_INTERVAL")); err == nil && interval > 0 {
+		store.InventoryInterval = interval
+	}
+
+	if after, err := time.ParseDuration(os.Getenv("STUCK_ON_AFTER")); err == nil && after > 0 {
+		alerts.StuckOnAfter = after
+	}
+
+	shutdownTimeout := 15 * time.Second
+	if timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && timeout > 0 {
+		shutdownTimeout = timeout
+	}
+
+	alertPort := os.Getenv("ALERT_PUBLISHER_PORT")
+	if len(alertPort) == 0 {
+		alertPort = "7004"
+	}
 
+	alertPublisher, err := publisher.NewPublisher(alertPort, 1000, 10)
+	if err != nil {
+		log.Fatalf("Error creating alert publisher: %s", err.Error())
+	}
+
+	//Listen only returns if it can't start, and then nothing drains what's written to the publisher, so raising alerts would block the pipeline
 	go func() {
-		log.Printf("Waiting for SIGTERM signal...")
-		output := <-signals
-		log.Printf("output: %v", output)
-		log.Printf("Nuclear launch detected. Firing interceptors...")
-		for i := 0; i < NUM_PROCESSES; i++ {
-			timer <- true
-		}
-		//	control.Wait()
-		//	os.Exit(0)
+		err := alertPublisher.Listen()
+		log.Fatalf("Error publishing alerts on port %s: %v", alertPort, err)
 	}()
 
-	events := make(chan salt.SaltEvent)
-	control.Add(NUM_PROCESSES)
-	go salt.Listen(events, timer, &control)
-	go store.Listen(events, timer, &control)
+	alertManager := alerts.NewManager(alertPublisher)
+	err = alertManager.SetAlertStore(alerts.Saved(db))
+	if err != nil {
+		log.Printf("Error loading active alerts from the store: %s", err.Error())
+	}
+
+	alertMonitor := alerts.NewMonitor(alertManager, db)
+	err = alertMonitor.Seed()
+	if err != nil {
+		log.Printf("Error checking the store for alerts: %s", err.Error())
+	}
+
+	tracker := summary.NewTracker(alertManager, db)
+	err = tracker.Seed()
+	if err != nil {
+		log.Printf("Error loading summary from the store: %s", err.Error())
+	}
+
+	//every event, whatever its source, is stored, checked for alerts and counted in the summary. one that can't be stored goes no further
+	events := pipeline.New(
+		pipeline.Stage{Name: "store", Handler: store.Handler(db), Required: true},
+		pipeline.Stage{Name: "alerts", Handler: alertMonitor},
+		pipeline.Stage{Name: "summary", Handler: tracker},
+	)
+
+	//canceled once the server has drained, which stops every worker
+	ctx, cancel := context.WithCancel(context.Background())
+
+	//a worker that panics is restarted, and fails the readiness check until it is
+	workers := supervisor.New()
+
+	//the server comes up right away and answers "warming up" until this finishes
+	workers.Go(ctx, "initial sync", func(ctx context.Context) error {
+		return store.OnStart(ctx, db, provider, events)
+	})
+
+	saltEvents := make(chan salt.SaltEvent)
+	routerEvents := make(chan eventinfrastructure.Event)
+	workers.Go(ctx, "salt", func(ctx context.Context) error {
+		return salt.Listen(ctx, saltEvents)
+	})
+	workers.Go(ctx, "event router", func(ctx context.Context) error {
+		return eventrouter.Listen(ctx, routerEvents)
+	})
+	workers.Go(ctx, "purge", func(ctx context.Context) error {
+		return store.RunPurge(ctx, db)
+	})
+	workers.Go(ctx, "reconciler", func(ctx context.Context) error {
+		return store.RunReconciler(ctx, db, events)
+	})
+	workers.Go(ctx, "inventory sync", func(ctx context.Context) error {
+		return store.RunInventorySync(ctx, db, provider, events)
+	})
+
+	//these can't fail short of panicking, which the supervisor turns into an error itself
+	workers.Go(ctx, "pipeline", func(ctx context.Context) error {
+		events.Run(ctx, saltEvents, routerEvents)
+		return nil
+	})
+	workers.Go(ctx, "alert monitor", func(ctx context.Context) error {
+		alertMonitor.Run(ctx)
+		return nil
+	})
+
+	//streams are closed as soon as the server starts draining, so they don't hold it open
+	streamCtx, closeStreams := context.WithCancel(ctx)
+	hub := stream.NewHub(db)
+	workers.Go(streamCtx, "stream hub", func(ctx context.Context) error {
+		hub.Run(ctx)
+		return nil
+	})
+
+	metrics.NewGaugeFunc("monster_store_size_bytes", "Bytes the store takes up on disk.", func() float64 {
+		size, err := db.Size()
+		if err != nil {
+			log.Printf("Error measuring the store: %s", err.Error())
+		}
+		return float64(size)
+	})
+
+	readiness.Register("store", func() (time.Time, error) {
+		return time.Time{}, store.Ping(db)
+	})
+	readiness.Register("initial sync", store.SyncReady)
+	if len(os.Getenv("SALT_MASTER_ADDRESS")) > 0 {
+		readiness.Register("salt event stream", salt.StreamReady)
+		readiness.Register("salt token", salt.TokenReady)
+	}
+	if len(os.Getenv("EVENT_ROUTER_ADDRESS")) > 0 {
+		readiness.Register("event router", eventrouter.Ready)
+	}
 
 	port := ":10000"
 	router := echo.New()
 	router.Pre(middleware.RemoveTrailingSlash())
 	router.Use(middleware.CORS())
+	router.Use(handlers.Instrument)
+
+	//probes and scrapers don't authenticate
+	router.GET("/health", echo.WrapHandler(http.HandlerFunc(health.Check)))
+	router.GET("/ready", handlers.Ready)
+	router.GET("/metrics", handlers.Metrics)
 
 	// Use the `secure` routing group to require authentication
 	secure := router.Group("", echo.WrapMiddleware(authmiddleware.Authenticate))
 
-	secure.GET("/buildings/:building/rooms/:room", handlers.ViewRoom)
+	secure.GET("/buildings", handlers.ListBuildings(db), handlers.RequireSync)
+	secure.GET("/buildings/:building/rooms", handlers.ListRooms(db), handlers.RequireSync)
+	secure.GET("/rooms", handlers.ListRooms(db), handlers.RequireSync)
+	secure.GET("/buildings/:building/rooms/:room", handlers.ViewRoom(db), handlers.RequireSync)
+	secure.GET("/buildings/:building/rooms/:room/history", handlers.GetRoomHistory(db), handlers.RequireSync)
+	secure.POST("/buildings/:building/reconcile", handlers.ReconcileBuilding(db, events))
+	secure.POST("/buildings/:building/rooms/:room/reconcile", handlers.ReconcileRoom(db, events))
+	secure.GET("/alerts", handlers.GetAlerts(alertManager))
+	secure.GET("/summary", handlers.GetSummary(tracker), handlers.RequireSync)
+	secure.GET("/ws", handlers.StreamWebSocket(hub), handlers.RequireSync)
+	secure.GET("/events/stream", handlers.StreamEvents(hub), handlers.RequireSync)
+	secure.GET("/inventory/changes", handlers.GetInventoryChanges(db))
+	secure.POST("/inventory/sync", handlers.SyncInventory(db, provider, events))
+	secure.GET("/status/salt", handlers.SaltStatus)
+	secure.GET("/status/sync", handlers.SyncStatus)
+	secure.GET("/status/eventrouter", handlers.EventRouterStatus)
+	secure.GET("/status/workers", handlers.WorkerStatus(workers))
+
+	secure.GET("/minions/unassigned", handlers.GetUnassignedMinions)
+	secure.GET("/minions/overrides", handlers.GetMinionOverrides)
+	secure.GET("/minions/:minion", handlers.ResolveMinion)
+	secure.PUT("/minions/:minion/override", handlers.SetMinionOverride)
+	secure.DELETE("/minions/:minion/override", handlers.RemoveMinionOverride)
 
 	secure.Static("/", "dist")
 
-	server := http.Server{
+	server := &http.Server{
 		Addr:           port,
+		Handler:        router,
 		MaxHeaderBytes: 1024 * 10,
 	}
+	server.RegisterOnShutdown(closeStreams)
+
+	serverErrs := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s...", port)
+		serverErrs <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	code := 0
+
+	select {
+	case sig := <-signals:
+		log.Printf("Received %s. Shutting down...", sig)
+	case err := <-serverErrs:
+		log.Printf("Error serving on %s: %s. Shutting down...", port, err.Error())
+		code = 1
+	}
+
+	//a second signal skips the rest of the shutdown
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s again. Exiting now", sig)
+		os.Exit(1)
+	}()
+
+	if !shutdown(server, cancel, workers, shutdownTimeout) {
+		code = 1
+	}
+
+	//anything still submitting, if workers timed out, gives up instead of waiting on a pipeline that won't run again
+	events.Stop()
+
+	//badger flushes everything still in memory to disk as it closes. if workers timed out, Close waits for any store
+	//operation they're in the middle of and fails the rest, rather than pulling the store out from under them
+	err = db.Close()
+	if err != nil {
+		log.Printf("Error closing the store: %s", err.Error())
+		code = 1
+	}
+
+	log.Printf("Shut down")
+	os.Exit(code)
+}
+
+//stops taking requests and lets the ones in flight finish, then stops the workers and waits for them. returns false if anything didn't stop within timeout
+func shutdown(server *http.Server, cancel context.CancelFunc, workers *supervisor.Supervisor, timeout time.Duration) bool {
+
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+	defer cancelTimeout()
+
+	clean := true
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Error draining requests: %s", err.Error())
+		clean = false
+	}
+
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Printf("Timed out after %s waiting for workers to stop", timeout)
+		clean = false
+	}
 
-	router.StartServer(&server)
-	control.Wait()
+	return clean
 }
@@ -0,0 +1,141 @@
+//decodes text/event-stream bodies as described in the HTML Server-Sent Events spec
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//largest single line the decoder will accept. salt job returns can get big
+var MaxLineSize = 16 << 20
+
+type Event struct {
+	ID   string //last event ID in effect when the event was dispatched
+	Type string //"message" unless the stream set an event field
+	Data string //data fields joined with newlines
+}
+
+type Decoder struct {
+	scanner *bufio.Scanner
+	started bool
+	lastID  string
+	retry   time.Duration
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	scanner.Split(scanLines)
+
+	return &Decoder{scanner: scanner}
+}
+
+//returns the ID of the last event that set one, so a reconnect can send it as Last-Event-ID
+func (d *Decoder) LastEventID() string {
+	return d.lastID
+}
+
+//returns the reconnection time requested by the stream, or zero if it never sent one
+func (d *Decoder) Retry() time.Duration {
+	return d.retry
+}
+
+//blocks until the next complete event arrives. an event cut off by the end of the stream is discarded and io.EOF returned
+func (d *Decoder) Decode() (Event, error) {
+
+	var eventType string
+	var data bytes.Buffer
+	hasData := false
+
+	for d.scanner.Scan() {
+		line := d.scanner.Text()
+
+		if !d.started {
+			d.started = true
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		//a blank line dispatches whatever has been buffered
+		if len(line) == 0 {
+			if !hasData {
+				eventType = ""
+				continue
+			}
+
+			if len(eventType) == 0 {
+				eventType = "message"
+			}
+
+			return Event{
+				ID:   d.lastID,
+				Type: eventType,
+				Data: strings.TrimSuffix(data.String(), "\n"),
+			}, nil
+		}
+
+		//comments are used as keep-alives
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field = line[:i]
+			value = strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				d.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+		//anything else (salt sends a "tag" field) is ignored, as the spec requires
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+//like bufio.ScanLines, but a line can end in \r\n, \n or a lone \r
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+
+		//a \r at the end of the buffer might be the first half of a \r\n
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
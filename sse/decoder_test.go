@@ -0,0 +1,258 @@
+package sse
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+//a salt-api /events stream, captured from a master with two minions
+const transcript = "testdata/salt-events.txt"
+
+var decodeTests = []struct {
+	name   string
+	stream string
+	events []Event
+	lastID string
+	retry  time.Duration
+}{
+	{
+		name:   "single event",
+		stream: "data: hello\n\n",
+		events: []Event{{Type: "message", Data: "hello"}},
+	},
+	{
+		name:   "multi-line data",
+		stream: "data: one\ndata: two\ndata:three\n\n",
+		events: []Event{{Type: "message", Data: "one\ntwo\nthree"}},
+	},
+	{
+		name:   "empty data field",
+		stream: "data\ndata: after\n\n",
+		events: []Event{{Type: "message", Data: "\nafter"}},
+	},
+	{
+		name:   "event type",
+		stream: "event: update\ndata: a\n\ndata: b\n\n",
+		events: []Event{{Type: "update", Data: "a"}, {Type: "message", Data: "b"}},
+	},
+	{
+		name:   "id carries over",
+		stream: "id: 7\ndata: a\n\ndata: b\n\n",
+		events: []Event{{ID: "7", Type: "message", Data: "a"}, {ID: "7", Type: "message", Data: "b"}},
+		lastID: "7",
+	},
+	{
+		name:   "empty id resets",
+		stream: "id: 7\ndata: a\n\nid\ndata: b\n\n",
+		events: []Event{{ID: "7", Type: "message", Data: "a"}, {Type: "message", Data: "b"}},
+	},
+	{
+		name:   "id with NUL is ignored",
+		stream: "id: 7\ndata: a\n\nid: 8\x009\ndata: b\n\n",
+		events: []Event{{ID: "7", Type: "message", Data: "a"}, {ID: "7", Type: "message", Data: "b"}},
+		lastID: "7",
+	},
+	{
+		name:   "retry",
+		stream: "retry: 400\n\ndata: a\n\n",
+		events: []Event{{Type: "message", Data: "a"}},
+		retry:  400 * time.Millisecond,
+	},
+	{
+		name:   "invalid retry is ignored",
+		stream: "retry: 400\n\nretry: soon\nretry: -1\ndata: a\n\n",
+		events: []Event{{Type: "message", Data: "a"}},
+		retry:  400 * time.Millisecond,
+	},
+	{
+		name:   "comments",
+		stream: ": keep-alive\n\n:\ndata: a\n: in the middle\ndata: b\n\n",
+		events: []Event{{Type: "message", Data: "a\nb"}},
+	},
+	{
+		name:   "CR line endings",
+		stream: "id: 1\rdata: a\r\rdata: b\r\r",
+		events: []Event{{ID: "1", Type: "message", Data: "a"}, {ID: "1", Type: "message", Data: "b"}},
+		lastID: "1",
+	},
+	{
+		name:   "CRLF line endings",
+		stream: "id: 1\r\ndata: a\r\ndata: b\r\n\r\n",
+		events: []Event{{ID: "1", Type: "message", Data: "a\nb"}},
+		lastID: "1",
+	},
+	{
+		name:   "mixed line endings",
+		stream: "data: a\r\ndata: b\rdata: c\n\r\n",
+		events: []Event{{Type: "message", Data: "a\nb\nc"}},
+	},
+	{
+		name:   "BOM",
+		stream: "\ufeffdata: a\n\n",
+		events: []Event{{Type: "message", Data: "a"}},
+	},
+	{
+		name:   "BOM only stripped at the start",
+		stream: "data: a\n\n\ufeffdata: b\n\n",
+		events: []Event{{Type: "message", Data: "a"}},
+	},
+	{
+		name:   "salt tag field is ignored",
+		stream: "tag: salt/auth\ndata: {\"tag\": \"salt/auth\", \"data\": {\"act\": \"accept\"}}\n\n",
+		events: []Event{{Type: "message", Data: `{"tag": "salt/auth", "data": {"act": "accept"}}`}},
+	},
+	{
+		name:   "blank lines without data dispatch nothing",
+		stream: "\n\nevent: ignored\n\ndata: a\n\n",
+		events: []Event{{Type: "message", Data: "a"}},
+	},
+	{
+		name:   "event cut off by EOF",
+		stream: "data: a\n\ndata: b\n",
+		events: []Event{{Type: "message", Data: "a"}},
+	},
+	{
+		name:   "event cut off mid line",
+		stream: "data: a\n\ndata: b",
+		events: []Event{{Type: "message", Data: "a"}},
+	},
+	{
+		name:   "empty stream",
+		stream: "",
+	},
+}
+
+//decodes every event in r and returns them along with the error that stopped decoding
+func decodeAll(r io.Reader) (*Decoder, []Event, error) {
+	decoder := NewDecoder(r)
+
+	var events []Event
+	for {
+		event, err := decoder.Decode()
+		if err != nil {
+			return decoder, events, err
+		}
+		events = append(events, event)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, test := range decodeTests {
+		t.Run(test.name, func(t *testing.T) {
+
+			//reading a byte at a time splits every \r\n across reads
+			readers := map[string]io.Reader{
+				"whole":    strings.NewReader(test.stream),
+				"one byte": iotest.OneByteReader(strings.NewReader(test.stream)),
+			}
+
+			for name, r := range readers {
+				decoder, events, err := decodeAll(r)
+				if err != io.EOF {
+					t.Fatalf("%s: got error %v, want io.EOF", name, err)
+				}
+				if !reflect.DeepEqual(events, test.events) {
+					t.Errorf("%s: got events %q, want %q", name, events, test.events)
+				}
+				if decoder.LastEventID() != test.lastID {
+					t.Errorf("%s: got last event ID %q, want %q", name, decoder.LastEventID(), test.lastID)
+				}
+				if decoder.Retry() != test.retry {
+					t.Errorf("%s: got retry %s, want %s", name, decoder.Retry(), test.retry)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeTranscript(t *testing.T) {
+	stream, err := ioutil.ReadFile(transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, events, err := decodeAll(strings.NewReader(string(stream)))
+	if err != io.EOF {
+		t.Fatalf("got error %v, want io.EOF", err)
+	}
+	if len(events) != 9 {
+		t.Fatalf("got %d events, want 9", len(events))
+	}
+	if decoder.Retry() != 400*time.Millisecond {
+		t.Errorf("got retry %s, want 400ms", decoder.Retry())
+	}
+
+	for _, event := range events {
+		var body struct {
+			Tag  string                 `json:"tag"`
+			Data map[string]interface{} `json:"data"`
+		}
+		err := json.Unmarshal([]byte(event.Data), &body)
+		if err != nil {
+			t.Errorf("event data isn't JSON: %s: %q", err.Error(), event.Data)
+			continue
+		}
+		if len(body.Tag) == 0 {
+			t.Errorf("event has no tag: %q", event.Data)
+		}
+	}
+}
+
+func TestDecodeLongLine(t *testing.T) {
+	data := strings.Repeat("x", 256*1024)
+
+	_, events, err := decodeAll(strings.NewReader("data: " + data + "\n\n"))
+	if err != io.EOF {
+		t.Fatalf("got error %v, want io.EOF", err)
+	}
+	if len(events) != 1 || events[0].Data != data {
+		t.Fatalf("long data line wasn't decoded intact")
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	stream, err := ioutil.ReadFile(transcript)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(stream)
+
+	//each captured event on its own, plus the table cases
+	for _, event := range strings.SplitAfter(string(stream), "\n\n") {
+		f.Add([]byte(event))
+	}
+	for _, test := range decodeTests {
+		f.Add([]byte(test.stream))
+	}
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		decoder, events, err := decodeAll(strings.NewReader(string(stream)))
+		if err != io.EOF {
+			t.Fatalf("got error %v, want io.EOF", err)
+		}
+
+		for _, event := range events {
+			if len(event.Type) == 0 {
+				t.Errorf("event has no type: %q", event)
+			}
+			if strings.ContainsAny(event.Data, "\r") || strings.ContainsRune(event.ID, 0) {
+				t.Errorf("line ending or NUL leaked into an event: %q", event)
+			}
+		}
+
+		//how the stream is split across reads must not change what's decoded
+		split, splitEvents, _ := decodeAll(iotest.OneByteReader(strings.NewReader(string(stream))))
+		if !reflect.DeepEqual(events, splitEvents) {
+			t.Errorf("decoding a byte at a time gave %q, want %q", splitEvents, events)
+		}
+		if split.LastEventID() != decoder.LastEventID() || split.Retry() != decoder.Retry() {
+			t.Errorf("decoding a byte at a time changed the stream state")
+		}
+	})
+}
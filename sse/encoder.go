@@ -0,0 +1,54 @@
+package sse
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+)
+
+//writes text/event-stream bodies, flushing after every event so they aren't held in a buffer
+type Encoder struct {
+	w       *bufio.Writer
+	flusher http.Flusher
+}
+
+//w is flushed after each event if it's an http.Flusher
+func NewEncoder(w io.Writer) *Encoder {
+	flusher, _ := w.(http.Flusher)
+	return &Encoder{w: bufio.NewWriter(w), flusher: flusher}
+}
+
+//writes one event. an empty type is sent as the default "message"
+func (e *Encoder) Encode(event Event) error {
+
+	if len(event.ID) > 0 {
+		e.w.WriteString("id: " + event.ID + "\n")
+	}
+	if len(event.Type) > 0 && event.Type != "message" {
+		e.w.WriteString("event: " + event.Type + "\n")
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		e.w.WriteString("data: " + line + "\n")
+	}
+	e.w.WriteString("\n")
+
+	return e.flush()
+}
+
+//writes a comment line, which clients ignore. useful to keep idle connections open
+func (e *Encoder) Comment(text string) error {
+	e.w.WriteString(": " + text + "\n")
+	return e.flush()
+}
+
+func (e *Encoder) flush() error {
+	err := e.w.Flush()
+	if err != nil {
+		return err
+	}
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return nil
+}
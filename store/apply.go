@@ -0,0 +1,327 @@
+package store
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+//the pipeline stage that keeps the store up to date
+func Handler(s Store) pipeline.Handler {
+	return pipeline.HandlerFunc(func(event pipeline.Event) error {
+		return Apply(s, event)
+	})
+}
+
+//folds one event into the stored room and device records, recording history for anything that changed.
+//inventory notices add and remove records. other notices, and room-wide keys the room record has no place for, are kept as events instead
+func Apply(s Store, event pipeline.Event) error {
+
+	if event.Key == pipeline.KeyInventory {
+		return applyInventory(s, event)
+	}
+
+	if event.IsNotice() {
+		return putEvent(s, event)
+	}
+
+	if event.Key == pipeline.KeyVerified {
+		return verifyRoom(s, event)
+	}
+
+	if len(event.Device) == 0 {
+		applied, err := updateRoom(s, event, true, func(room *base.PublicRoom) bool {
+			return setRoomField(room, event.Key, event.Value)
+		})
+		if err != nil || applied {
+			return err
+		}
+		return putEvent(s, event)
+	}
+
+	switch event.Key {
+	case pipeline.KeyMinion, pipeline.KeyOnline, pipeline.KeyJob:
+		return updateDevice(s, event.Source, event.Building, event.Room, event.Device, func(record *DeviceRecord) {
+			setDeviceField(record, event)
+		})
+	}
+
+	//displays and audio devices live in the room record, if we have one
+	applied, err := updateRoom(s, event, false, func(room *base.PublicRoom) bool {
+		return setRoomDeviceField(room, event.Device, event.Key, event.Value)
+	})
+	if err != nil || applied {
+		return err
+	}
+
+	return updateDevice(s, event.Source, event.Building, event.Room, event.Device, func(record *DeviceRecord) {
+		record.State[event.Key] = event.Value
+	})
+}
+
+//marks a room's record as current without changing anything in it. rooms without a record are left alone
+func verifyRoom(s Store, event pipeline.Event) error {
+
+	record, err := GetRoom(s, event.Building, event.Room)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	record.Updated = time.Now()
+	record.Source = event.Source
+
+	return put(s, RoomKey(event.Building, event.Room), record)
+}
+
+//applies update to the stored record for a room. if the room has no record, one is created only when create is set.
+//returns whether update found a place for the event
+func updateRoom(s Store, event pipeline.Event, create bool, update func(*base.PublicRoom) bool) (bool, error) {
+
+	record, err := GetRoom(s, event.Building, event.Room)
+	if err == ErrNotFound {
+		if !create {
+			return false, nil
+		}
+		record.Room = base.PublicRoom{Building: event.Building, Room: event.Room}
+	} else if err != nil {
+		return false, err
+	}
+
+	before := flattenRoom(record.Room)
+
+	//update may touch the device slices, so give it its own copies
+	record.Room.Displays = append([]base.Display{}, record.Room.Displays...)
+	record.Room.AudioDevices = append([]base.AudioDevice{}, record.Room.AudioDevices...)
+
+	if !update(&record.Room) {
+		return false, nil
+	}
+	record.Updated = time.Now()
+	record.Source = event.Source
+
+	changes := diff(event.Building, event.Room, event.Source, before, flattenRoom(record.Room))
+
+	return true, putWithHistory(s, RoomKey(event.Building, event.Room), record, changes)
+}
+
+func setRoomField(room *base.PublicRoom, key, value string) bool {
+
+	switch key {
+	case pipeline.KeyPower:
+		room.Power = value
+	case pipeline.KeyInput:
+		room.CurrentVideoInput = value
+	case pipeline.KeyAudioInput:
+		room.CurrentAudioInput = value
+	case pipeline.KeyBlanked:
+		room.Blanked = parseBool(value)
+	case pipeline.KeyMuted:
+		room.Muted = parseBool(value)
+	case pipeline.KeyVolume:
+		room.Volume = parseInt(value)
+	default:
+		return false
+	}
+
+	return true
+}
+
+//sets a field on a room's display or audio device. a role, or a field only one kind of device has, adds the device if it's missing.
+//an empty value clears the field, and an empty role removes the device
+func setRoomDeviceField(room *base.PublicRoom, device, key, value string) bool {
+
+	if len(value) == 0 {
+		return clearRoomDeviceField(room, device, key)
+	}
+
+	display := -1
+	for i := range room.Displays {
+		if room.Displays[i].Name == device {
+			display = i
+		}
+	}
+
+	audio := -1
+	for i := range room.AudioDevices {
+		if room.AudioDevices[i].Name == device {
+			audio = i
+		}
+	}
+
+	addDisplay := func() {
+		if display < 0 {
+			room.Displays = append(room.Displays, base.Display{Device: base.Device{Name: device}})
+			display = len(room.Displays) - 1
+		}
+	}
+	addAudio := func() {
+		if audio < 0 {
+			room.AudioDevices = append(room.AudioDevices, base.AudioDevice{Device: base.Device{Name: device}})
+			audio = len(room.AudioDevices) - 1
+		}
+	}
+
+	switch key {
+	case pipeline.KeyRole:
+		switch value {
+		case pipeline.RoleDisplay:
+			addDisplay()
+		case pipeline.RoleAudio:
+			addAudio()
+		default:
+			return false
+		}
+
+	case pipeline.KeyPower, pipeline.KeyInput:
+		if display < 0 && audio < 0 {
+			return false
+		}
+		if display >= 0 {
+			if key == pipeline.KeyPower {
+				room.Displays[display].Power = value
+			} else {
+				room.Displays[display].Input = value
+			}
+		}
+		if audio >= 0 {
+			if key == pipeline.KeyPower {
+				room.AudioDevices[audio].Power = value
+			} else {
+				room.AudioDevices[audio].Input = value
+			}
+		}
+
+	case pipeline.KeyBlanked:
+		addDisplay()
+		room.Displays[display].Blanked = parseBool(value)
+
+	case pipeline.KeyMuted:
+		addAudio()
+		room.AudioDevices[audio].Muted = parseBool(value)
+
+	case pipeline.KeyVolume:
+		addAudio()
+		room.AudioDevices[audio].Volume = parseInt(value)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+func clearRoomDeviceField(room *base.PublicRoom, device, key string) bool {
+
+	switch key {
+	case pipeline.KeyRole, pipeline.KeyPower, pipeline.KeyInput, pipeline.KeyBlanked, pipeline.KeyMuted, pipeline.KeyVolume:
+	default:
+		return false
+	}
+
+	displays := room.Displays[:0]
+	for _, display := range room.Displays {
+		if display.Name == device {
+			if key == pipeline.KeyRole {
+				continue
+			}
+			switch key {
+			case pipeline.KeyPower:
+				display.Power = ""
+			case pipeline.KeyInput:
+				display.Input = ""
+			case pipeline.KeyBlanked:
+				display.Blanked = nil
+			}
+		}
+		displays = append(displays, display)
+	}
+	room.Displays = displays
+
+	audioDevices := room.AudioDevices[:0]
+	for _, audio := range room.AudioDevices {
+		if audio.Name == device {
+			if key == pipeline.KeyRole {
+				continue
+			}
+			switch key {
+			case pipeline.KeyPower:
+				audio.Power = ""
+			case pipeline.KeyInput:
+				audio.Input = ""
+			case pipeline.KeyMuted:
+				audio.Muted = nil
+			case pipeline.KeyVolume:
+				audio.Volume = nil
+			}
+		}
+		audioDevices = append(audioDevices, audio)
+	}
+	room.AudioDevices = audioDevices
+
+	return true
+}
+
+//applies the salt side of a device: which minion it is, whether it's online, and its last job
+func setDeviceField(record *DeviceRecord, event pipeline.Event) {
+
+	switch event.Key {
+	case pipeline.KeyMinion:
+		record.Minion = event.Value
+
+	case pipeline.KeyOnline:
+		record.Online = event.Value == "true"
+		if record.Online {
+			record.LastSeen = event.Timestamp
+		}
+
+	case pipeline.KeyJob:
+		var job pipeline.JobResult
+		if json.Unmarshal([]byte(event.Value), &job) != nil {
+			return
+		}
+		record.LastJob = &JobResult{
+			JID:      job.JID,
+			Function: job.Function,
+			Success:  job.Success,
+			RetCode:  job.RetCode,
+			Time:     event.Timestamp,
+		}
+	}
+}
+
+func putEvent(s Store, event pipeline.Event) error {
+	return put(s, EventKey(event.Building, event.Room, nextStamp()), eventRecord(event))
+}
+
+func eventRecord(event pipeline.Event) EventRecord {
+	return EventRecord{
+		Building: event.Building,
+		Room:     event.Room,
+		Device:   event.Device,
+		Key:      event.Key,
+		Value:    event.Value,
+		Time:     event.Timestamp,
+		Source:   event.Source,
+	}
+}
+
+func parseBool(value string) *bool {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil
+	}
+	return &b
+}
+
+func parseInt(value string) *int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &i
+}
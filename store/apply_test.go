@@ -0,0 +1,226 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+//applies submitted events straight to a store, standing in for the pipeline
+type applySink struct {
+	t *testing.T
+	s Store
+}
+
+func (a applySink) Submit(events ...pipeline.Event) {
+	for _, event := range events {
+		err := Apply(a.s, event)
+		if err != nil {
+			a.t.Fatalf("error applying %s %s: %s", event.Key, event.Value, err.Error())
+		}
+	}
+}
+
+func event(device, key, value string) pipeline.Event {
+	return pipeline.Event{
+		Source:    pipeline.SourceAVAPI,
+		Timestamp: time.Now(),
+		Building:  "ITB",
+		Room:      "1101",
+		Device:    device,
+		Key:       key,
+		Value:     value,
+	}
+}
+
+func TestApplyRoomFields(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	sink.Submit(event("", pipeline.KeyPower, "on"), event("", pipeline.KeyVolume, "30"))
+
+	record, err := GetRoom(s, "ITB", "1101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Room.Power != "on" || record.Room.Volume == nil || *record.Room.Volume != 30 {
+		t.Errorf("room fields weren't applied: %+v", record.Room)
+	}
+	if record.Source != pipeline.SourceAVAPI {
+		t.Errorf("got source %q, want %q", record.Source, pipeline.SourceAVAPI)
+	}
+
+	//an empty value clears the field
+	sink.Submit(event("", pipeline.KeyPower, ""))
+
+	record, _ = GetRoom(s, "ITB", "1101")
+	if record.Room.Power != "" {
+		t.Errorf("got power %q, want it cleared", record.Room.Power)
+	}
+}
+
+func TestApplyRoomDevices(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	sink.Submit(
+		event("", pipeline.KeyPower, "on"),
+		event("D1", pipeline.KeyRole, pipeline.RoleDisplay),
+		event("D1", pipeline.KeyPower, "on"),
+		event("D1", pipeline.KeyBlanked, "true"),
+		event("MIC1", pipeline.KeyMuted, "false"),
+	)
+
+	record, err := GetRoom(s, "ITB", "1101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Room.Displays) != 1 || record.Room.Displays[0].Power != "on" || record.Room.Displays[0].Blanked == nil || !*record.Room.Displays[0].Blanked {
+		t.Errorf("display wasn't applied: %+v", record.Room.Displays)
+	}
+	if len(record.Room.AudioDevices) != 1 || record.Room.AudioDevices[0].Name != "MIC1" {
+		t.Errorf("a field only audio devices have should add one: %+v", record.Room.AudioDevices)
+	}
+
+	//room devices live in the room record, not their own
+	_, err = GetDevice(s, "ITB", "1101", "D1")
+	if err != ErrNotFound {
+		t.Errorf("got error %v looking up D1's device record, want ErrNotFound", err)
+	}
+
+	//an empty role takes the device out of the room
+	sink.Submit(event("D1", pipeline.KeyRole, ""))
+
+	record, _ = GetRoom(s, "ITB", "1101")
+	if len(record.Room.Displays) != 0 {
+		t.Errorf("got displays %+v, want none", record.Room.Displays)
+	}
+}
+
+func TestApplyDeviceRecords(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	sink.Submit(
+		event("CP1", pipeline.KeyMinion, "ITB-1101-CP1.byu.edu"),
+		event("CP1", pipeline.KeyOnline, "false"),
+		event("CP1", "firmware", "1.2.3"),
+	)
+
+	device, err := GetDevice(s, "ITB", "1101", "CP1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Minion != "ITB-1101-CP1.byu.edu" || device.Online {
+		t.Errorf("salt fields weren't applied: %+v", device)
+	}
+	if !device.Offline() {
+		t.Errorf("a salt managed device that isn't online should be offline")
+	}
+	if device.State["firmware"] != "1.2.3" {
+		t.Errorf("got state %v, want free-form keys kept", device.State)
+	}
+
+	//without a minion salt doesn't manage it, so it can't be offline
+	if (DeviceRecord{Online: false}).Offline() {
+		t.Errorf("a device without a minion shouldn't be offline")
+	}
+}
+
+func TestApplyNotices(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	sink.Submit(event("", pipeline.KeyDiscrepancy, `power: stored "on", polled "standby"`))
+
+	count := 0
+	err := s.Scan(Prefix(EventClass, "ITB", "1101"), func(key, value []byte) error {
+		var record EventRecord
+		err := Decode(value, &record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Key != pipeline.KeyDiscrepancy {
+			t.Errorf("got event key %q, want %q", record.Key, pipeline.KeyDiscrepancy)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d events, want 1", count)
+	}
+
+	//notices aren't room state
+	_, err = GetRoom(s, "ITB", "1101")
+	if err != ErrNotFound {
+		t.Errorf("got error %v, want a notice not to create the room", err)
+	}
+}
+
+func TestApplyVerified(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	//a room we have no record of isn't created just because it was polled
+	sink.Submit(pipeline.Verified("ITB", "1101", pipeline.SourceReconcile))
+	_, err := GetRoom(s, "ITB", "1101")
+	if err != ErrNotFound {
+		t.Fatalf("got error %v, want ErrNotFound", err)
+	}
+
+	sink.Submit(event("", pipeline.KeyPower, "on"))
+	before, _ := GetRoom(s, "ITB", "1101")
+
+	history, _ := GetHistory(s, "ITB", "1101", "", time.Time{}, time.Now())
+
+	time.Sleep(time.Millisecond)
+	sink.Submit(pipeline.Verified("ITB", "1101", pipeline.SourceReconcile))
+
+	after, _ := GetRoom(s, "ITB", "1101")
+	if !after.Updated.After(before.Updated) || after.Source != pipeline.SourceReconcile {
+		t.Errorf("verifying didn't mark the room current: %v %q", after.Updated, after.Source)
+	}
+	if after.Room.Power != "on" {
+		t.Errorf("verifying changed the room: %+v", after.Room)
+	}
+
+	again, _ := GetHistory(s, "ITB", "1101", "", time.Time{}, time.Now())
+	if len(again) != len(history) {
+		t.Errorf("verifying recorded history: got %d records, want %d", len(again), len(history))
+	}
+}
+
+func TestApplyUnchangedDevice(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	sink.Submit(event("CP1", pipeline.KeyMinion, "ITB-1101-CP1"), event("CP1", pipeline.KeyOnline, "false"))
+	before, err := GetDevice(s, "ITB", "1101", "CP1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, cancel := s.Watch(Prefix(DeviceClass))
+	defer cancel()
+
+	//saying the same thing again writes nothing
+	sink.Submit(event("CP1", pipeline.KeyMinion, "ITB-1101-CP1"), event("CP1", pipeline.KeyOnline, "false"))
+
+	after, _ := GetDevice(s, "ITB", "1101", "CP1")
+	if !after.Updated.Equal(before.Updated) {
+		t.Errorf("an unchanged device was marked updated at %s", after.Updated)
+	}
+	if len(changes) != 0 {
+		t.Errorf("an unchanged device was written %d times", len(changes))
+	}
+
+	sink.Submit(event("CP1", pipeline.KeyOnline, "true"))
+	after, _ = GetDevice(s, "ITB", "1101", "CP1")
+	if !after.Online || !after.Updated.After(before.Updated) {
+		t.Errorf("a changed device wasn't written: %+v", after)
+	}
+}
@@ -3,125 +3,191 @@ package store
 
 import (
 	"bytes"
-	"encoding/gob"
-	"encoding/json"
-	"log"
-	"reflect"
+	"io/ioutil"
+	"path/filepath"
 	"sync"
+	"time"
 
-	"github.com/byuoitav/av-api/base"
-	"github.com/byuoitav/event-router-microservice/eventinfrastructure"
-	"github.com/byuoitav/monster-monitoring-service/salt"
 	"github.com/dgraph-io/badger/badger"
 	"github.com/dgraph-io/badger/table"
 )
 
-func Listen(events chan salt.SaltEvent, done chan bool, signal *sync.WaitGroup) {
+type badgerStore struct {
+	watchers
 
-	log.Printf("Listening for events...")
+	kv  *badger.KV
+	dir string
 
-	var event salt.SaltEvent
-	var listen sync.Once
+	//held from writing a batch until its watchers are notified, so they see batches in commit order
+	writes sync.Mutex
 
-	for {
-		select {
-		case <-done:
-			listen.Do(func() {
-				log.Printf("SIGTERM signal detected. Closing store...")
-				Store().Close()
-			})
-			break
-		case event = <-events:
-			err := UpdateStoreBySalt(event)
-			if err != nil {
-				log.Printf("Error updating store: %s", err.Error())
-			}
-		}
+	mutex    sync.Mutex
+	closed   bool
+	inFlight int
+	idle     *sync.Cond //signaled when inFlight drops to 0
+}
+
+//opens (or creates) a badger store in options.Dir
+func Open(options badger.Options) (Store, error) {
+	kv, err := badger.NewKV(&options)
+	if err != nil {
+		return nil, err
 	}
-	signal.Done()
+
+	b := &badgerStore{kv: kv, dir: options.Dir}
+	b.idle = sync.NewCond(&b.mutex)
+	return b, nil
 }
-func UpdateStoreBySalt(event salt.SaltEvent) error {
 
-	log.Printf("Adding event %s to store", event.Tag)
+//badger panics or blocks forever on a closed KV, so every operation is counted between begin and end, and Close waits for them.
+//once the store is closing begin fails
+func (b *badgerStore) begin() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
+	if b.closed {
+		return ErrClosed
+	}
+	b.inFlight++
 	return nil
 }
 
-func UpdateStoreByRoom(input base.PublicRoom) error {
-
-	log.Printf("Updating store by room: %s in building: %s...", input.Room, input.Building)
+func (b *badgerStore) end() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-	room := input.Building + "-" + input.Room
-	key := []byte(room)
+	b.inFlight--
+	if b.inFlight == 0 {
+		b.idle.Broadcast()
+	}
+}
 
-	temp, err := json.Marshal(input)
+//badger's Get has no error to return: it panics if the read fails
+func (b *badgerStore) Get(key []byte) ([]byte, error) {
+	err := b.begin()
 	if err != nil {
-		log.Printf("Error marshaling struct to JSON: %s", err.Error())
+		return nil, err
 	}
+	defer b.end()
 
-	value, _ := Store().Get(key)
-	if value != nil {
-		value = append(value, temp...)
-	} else {
-		value = temp
+	value, _ := b.kv.Get(key)
+	if value == nil {
+		return nil, ErrNotFound
 	}
+	return value, nil
+}
 
-	Store().Set(key, value)
+func (b *badgerStore) Put(key, value []byte) error {
+	return b.Batch([]Op{{Key: key, Value: value}})
+}
 
-	return nil
+func (b *badgerStore) Delete(key []byte) error {
+	return b.Batch([]Op{{Key: key, Delete: true}})
 }
 
-func UpdateStoreByEvent(event eventinfrastructure.Event) error {
+func (b *badgerStore) Scan(prefix []byte, fn func(key, value []byte) error) error {
+	err := b.begin()
+	if err != nil {
+		return err
+	}
+	defer b.end()
 
-	log.Printf("Updating store by event from device: %s...", event.Event.Device)
+	iterator := b.kv.NewIterator(badger.DefaultIteratorOptions)
+	defer iterator.Close()
 
-	room := event.Building + "-" + event.Room
-	key := []byte(room)
+	for iterator.Seek(prefix); iterator.Valid(); iterator.Next() {
+		item := iterator.Item()
+		if !bytes.HasPrefix(item.Key(), prefix) {
+			break
+		}
+
+		//the item is only valid until Next is called
+		key := append([]byte{}, item.Key()...)
+		value := append([]byte{}, item.Value()...)
 
-	temp := make(map[string]string)
-	temp[event.Event.EventInfoKey] = event.Event.EventInfoValue
-	bytes, err := GetBytes(temp)
+		err = fn(key, value)
+		if err == ErrStopScan {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *badgerStore) Batch(ops []Op) error {
+	err := b.begin()
 	if err != nil {
 		return err
 	}
-
-	value, _ := Store().Get(key)
-	if value != nil {
-		value = append(value, bytes...)
-	} else {
-		value = bytes
+	defer b.end()
+	defer writeLatency.Since(time.Now())
+
+	var entries []*badger.Entry
+	for _, op := range ops {
+		if op.Delete {
+			entries = badger.EntriesDelete(entries, op.Key)
+		} else {
+			entries = badger.EntriesSet(entries, op.Key, op.Value)
+		}
 	}
 
-	Store().Set(key, value)
+	b.writes.Lock()
+	defer b.writes.Unlock()
 
+	b.kv.BatchSet(entries)
+
+	for _, entry := range entries {
+		if entry.Error != nil {
+			return entry.Error
+		}
+	}
+
+	b.notify(ops)
 	return nil
 }
 
-//convert stuff to byte array
-func GetBytes(key interface{}) ([]byte, error) {
-	var buffer bytes.Buffer
-	encoder := gob.NewEncoder(&buffer)
-	err := encoder.Encode(key)
+func (b *badgerStore) Watch(prefix []byte) (<-chan Change, func()) {
+	return b.watch(prefix)
+}
+
+//adds up badger's tables and value logs. the directory may hold other files, so only those count
+func (b *badgerStore) Size() (int64, error) {
+
+	files, err := ioutil.ReadDir(b.dir)
 	if err != nil {
-		log.Printf("Error encoding struct of type %s: %s", reflect.TypeOf(key), err.Error())
-		return nil, err
+		return 0, err
 	}
-	return buffer.Bytes(), nil
-}
 
-//used to get instance of store
-func Store() *badger.KV {
-	once.Do(func() {
-		store, _ = badger.NewKV(&DefaultOptions)
-	})
-	return store
+	var size int64
+	for _, file := range files {
+		switch filepath.Ext(file.Name()) {
+		case ".sst", ".vlog":
+			size += file.Size()
+		}
+	}
+
+	return size, nil
 }
 
-//singleton instance of store
-var store *badger.KV
+//waits for operations already running to finish, and fails any that start after it's called
+func (b *badgerStore) Close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	for b.inFlight > 0 {
+		b.idle.Wait()
+	}
+	b.mutex.Unlock()
 
-//idiomatic way of implementing singleton pattern in golang
-var once sync.Once
+	b.closeAll()
+	b.kv.Close()
+	return nil
+}
 
 //should be safe, but can be tweaked
 var DefaultOptions = badger.Options{
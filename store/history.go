@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+//how long each class of timestamped record is kept before the purge deletes it
+var Retention = map[string]time.Duration{
+	EventClass:     7 * 24 * time.Hour,
+	HistoryClass:   90 * 24 * time.Hour,
+	ChangelogClass: 365 * 24 * time.Hour,
+}
+
+//how often the purge runs
+var PurgeInterval = 1 * time.Hour
+
+//stored under HistoryKey, one per field that changed
+type HistoryRecord struct {
+	Time     time.Time `json:"time"`
+	Building string    `json:"building"`
+	Room     string    `json:"room"`
+	Device   string    `json:"device,omitempty"`
+	Key      string    `json:"key"`
+	Old      string    `json:"old"`
+	New      string    `json:"new"`
+	Source   string    `json:"source"`
+}
+
+//returns the changes recorded for a room between from and to, oldest first. an empty device matches every device
+func GetHistory(s Store, building, room, device string, from, to time.Time) ([]HistoryRecord, error) {
+
+	toReturn := []HistoryRecord{}
+
+	err := s.Scan(Prefix(HistoryClass, building, room), func(key, value []byte) error {
+		_, segments := SplitKey(key)
+
+		stamp, err := ParseStamp(segments[len(segments)-1])
+		if err != nil {
+			return nil
+		}
+		if stamp.Before(from) {
+			return nil
+		}
+		//keys are in time order, so nothing after this can match
+		if stamp.After(to) {
+			return ErrStopScan
+		}
+
+		var record HistoryRecord
+		err = Decode(value, &record)
+		if err != nil {
+			log.Printf("Error decoding %s: %s", key, err.Error())
+			return nil
+		}
+
+		if len(device) == 0 || record.Device == device {
+			toReturn = append(toReturn, record)
+		}
+		return nil
+	})
+
+	return toReturn, err
+}
+
+//deletes records older than their class's retention every PurgeInterval until ctx is canceled. returns the error if a purge fails
+func RunPurge(ctx context.Context, s Store) error {
+
+	log.Printf("Purging old records every %s...", PurgeInterval)
+
+	ticker := time.NewTicker(PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Stopping purge")
+			return nil
+		case <-ticker.C:
+			err := Purge(s, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+//deletes every timestamped record that is older than its class's retention as of now.
+//a class that can't be purged doesn't stop the others, and the first such error is returned
+func Purge(s Store, now time.Time) error {
+
+	var failed error
+
+	for class, retention := range Retention {
+		cutoff := now.Add(-retention)
+
+		var expired []Op
+		err := s.Scan(Prefix(class), func(key, value []byte) error {
+			_, segments := SplitKey(key)
+
+			stamp, err := ParseStamp(segments[len(segments)-1])
+			if err == nil && stamp.Before(cutoff) {
+				expired = append(expired, Op{Key: key, Delete: true})
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error scanning %s records for purge: %s", class, err.Error())
+			if failed == nil {
+				failed = fmt.Errorf("error scanning %s records for purge: %s", class, err.Error())
+			}
+			continue
+		}
+
+		for len(expired) > 0 {
+			n := len(expired)
+			if n > 1000 {
+				n = 1000
+			}
+
+			err = s.Batch(expired[:n])
+			if err != nil {
+				log.Printf("Error purging %s records: %s", class, err.Error())
+				if failed == nil {
+					failed = fmt.Errorf("error purging %s records: %s", class, err.Error())
+				}
+				break
+			}
+			expired = expired[n:]
+		}
+
+		log.Printf("Purged %s records older than %s", class, cutoff.Format(time.RFC3339))
+	}
+
+	return failed
+}
+
+//turns a room into a flat set of device/key pairs so two snapshots can be compared field by field. room-wide fields have no device
+func flattenRoom(room base.PublicRoom) map[[2]string]string {
+
+	flat := make(map[[2]string]string)
+	for _, event := range pipeline.FromRoom(room, "") {
+		if event.Key != pipeline.KeyRole {
+			flat[[2]string{event.Device, event.Key}] = event.Value
+		}
+	}
+
+	return flat
+}
+
+//flattens the parts of a device record that count as state. last seen moves with every event, so it doesn't
+func flattenDevice(device DeviceRecord) map[[2]string]string {
+
+	flat := make(map[[2]string]string)
+
+	flat[[2]string{device.Device, "online"}] = strconv.FormatBool(device.Online)
+	if device.LastJob != nil {
+		flat[[2]string{device.Device, "lastJob"}] = device.LastJob.Function + " " + strconv.FormatBool(device.LastJob.Success)
+	}
+	for key, value := range device.State {
+		flat[[2]string{device.Device, key}] = value
+	}
+
+	return flat
+}
+
+//lists what differs between two flattened snapshots, in a stable order
+func diff(building, room, source string, old, new map[[2]string]string) []HistoryRecord {
+
+	var changes []HistoryRecord
+
+	add := func(field [2]string) {
+		if old[field] == new[field] {
+			return
+		}
+		changes = append(changes, HistoryRecord{
+			Building: building,
+			Room:     room,
+			Device:   field[0],
+			Key:      field[1],
+			Old:      old[field],
+			New:      new[field],
+			Source:   source,
+		})
+	}
+
+	for field := range new {
+		add(field)
+	}
+	for field := range old {
+		if _, ok := new[field]; !ok {
+			add(field)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Device != changes[j].Device {
+			return changes[i].Device < changes[j].Device
+		}
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+//encodes the changes so they can be written in the same batch as the state they describe
+func historyOps(changes []HistoryRecord) ([]Op, error) {
+
+	var ops []Op
+	for _, change := range changes {
+		stamp := nextStamp()
+		change.Time = stamp
+
+		value, err := Encode(change)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, Op{Key: HistoryKey(change.Building, change.Room, stamp), Value: value})
+	}
+
+	return ops, nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+func TestGetHistory(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	start := time.Now()
+	sink.Submit(event("", pipeline.KeyPower, "on"))
+	sink.Submit(event("D1", pipeline.KeyRole, pipeline.RoleDisplay), event("D1", pipeline.KeyInput, "hdmi1"))
+
+	middle := time.Now()
+	sink.Submit(event("", pipeline.KeyPower, "standby"), event("D1", pipeline.KeyInput, "hdmi2"))
+
+	//the same value again isn't a change
+	sink.Submit(event("", pipeline.KeyPower, "standby"))
+
+	all, err := GetHistory(s, "ITB", "1101", "", start, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d history records, want 4: %+v", len(all), all)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Errorf("history isn't oldest first: %+v", all)
+		}
+	}
+
+	power := all[2]
+	if power.Key != pipeline.KeyPower || power.Old != "on" || power.New != "standby" || power.Source != pipeline.SourceAVAPI {
+		t.Errorf("got %+v, want power going from on to standby", power)
+	}
+
+	later, _ := GetHistory(s, "ITB", "1101", "", middle, time.Now())
+	if len(later) != 2 {
+		t.Errorf("got %d records since the middle, want 2", len(later))
+	}
+
+	display, _ := GetHistory(s, "ITB", "1101", "D1", start, time.Now())
+	if len(display) != 2 {
+		t.Errorf("got %d records for D1, want 2", len(display))
+	}
+	for _, record := range display {
+		if record.Device != "D1" {
+			t.Errorf("got a record for %q filtering on D1", record.Device)
+		}
+	}
+
+	other, _ := GetHistory(s, "ITB", "1108", "", start, time.Now())
+	if len(other) != 0 {
+		t.Errorf("got %d records for a room with no history", len(other))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Now()
+
+	put := func(key []byte) {
+		err := s.Put(key, []byte("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired := [][]byte{
+		EventKey("ITB", "1101", now.Add(-Retention[EventClass]-time.Minute)),
+		HistoryKey("ITB", "1101", now.Add(-Retention[HistoryClass]-time.Minute)),
+		ChangelogKey(now.Add(-Retention[ChangelogClass] - time.Minute)),
+	}
+	kept := [][]byte{
+		EventKey("ITB", "1101", now.Add(-Retention[EventClass]+time.Minute)),
+		HistoryKey("ITB", "1101", now.Add(-time.Minute)),
+		ChangelogKey(now.Add(-Retention[EventClass] - time.Minute)),
+		RoomKey("ITB", "1101"),
+	}
+	for _, key := range append(expired, kept...) {
+		put(key)
+	}
+
+	err := Purge(s, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range expired {
+		if _, err := s.Get(key); err != ErrNotFound {
+			t.Errorf("%s wasn't purged", key)
+		}
+	}
+	for _, key := range kept {
+		if _, err := s.Get(key); err != nil {
+			t.Errorf("%s was purged: %v", key, err)
+		}
+	}
+}
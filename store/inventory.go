@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+//how often the store's rooms and devices are compared against the inventory
+var InventoryInterval = 1 * time.Hour
+
+//devices salt has heard from this recently aren't removed for being missing from the inventory, since salt's next event would only add them back
+var SaltGrace = 24 * time.Hour
+
+//the kinds of inventory change
+const (
+	RoomAdded     = "room added"
+	RoomRemoved   = "room removed"
+	DeviceAdded   = "device added"
+	DeviceRemoved = "device removed"
+
+	//not changes: sent at startup for everything in the inventory, so records exist before the first sync and it only reports real additions
+	RoomKnown   = "room known"
+	DeviceKnown = "device known"
+)
+
+//stored under ChangelogKey, one per room or device added or retired
+type ChangelogRecord struct {
+	Time     time.Time `json:"time"`
+	Change   string    `json:"change"`
+	Building string    `json:"building"`
+	Room     string    `json:"room"`
+	Device   string    `json:"device,omitempty"`
+}
+
+//syncs the inventory every InventoryInterval until ctx is canceled. returns the error if a sync fails
+func RunInventorySync(ctx context.Context, s Store, p inventory.Provider, sink pipeline.Sink) error {
+
+	log.Printf("Syncing inventory every %s...", InventoryInterval)
+
+	ticker := time.NewTicker(InventoryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Stopping inventory sync")
+			return nil
+		case <-ticker.C:
+			changes, err := SyncInventory(s, p, sink)
+			if err != nil {
+				return fmt.Errorf("error syncing inventory: %s", err.Error())
+			}
+			log.Printf("Inventory sync made %d changes", len(changes))
+		}
+	}
+}
+
+//finds rooms and devices that are new in the inventory or gone from it, and sends a notice down the pipeline for each.
+//devices salt is still hearing from, and their rooms, are never removed. the store is only changed as the pipeline applies them
+func SyncInventory(s Store, p inventory.Provider, sink pipeline.Sink) ([]ChangelogRecord, error) {
+
+	wanted, err := configuredInventory(p)
+	if err != nil {
+		return nil, err
+	}
+
+	//an empty inventory is far more likely to be an outage than a decommissioned campus
+	if len(wanted) == 0 {
+		return nil, errors.New("inventory returned no rooms. Skipping inventory sync")
+	}
+
+	rooms, err := ListRooms(s, "")
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := ListDevices(s, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[RoomID]map[string]bool)
+	for _, room := range rooms {
+		known[RoomID{Building: room.Room.Building, Room: room.Room.Room}] = make(map[string]bool)
+	}
+
+	//devices, and the rooms they're in, that are kept whatever the inventory says
+	salted := make(map[RoomID]map[string]bool)
+
+	for _, device := range devices {
+		id := RoomID{Building: device.Building, Room: device.Room}
+		if known[id] == nil {
+			known[id] = make(map[string]bool)
+		}
+		known[id][device.Device] = true
+
+		if len(device.Minion) > 0 && time.Since(device.LastSeen) < SaltGrace {
+			if salted[id] == nil {
+				salted[id] = make(map[string]bool)
+			}
+			salted[id][device.Device] = true
+		}
+	}
+
+	var changes []ChangelogRecord
+	change := func(kind string, room RoomID, device string) {
+		changes = append(changes, ChangelogRecord{Change: kind, Building: room.Building, Room: room.Room, Device: device})
+	}
+
+	for room, wantedDevices := range wanted {
+		knownDevices, ok := known[room]
+		if !ok {
+			change(RoomAdded, room, "")
+		}
+
+		for device := range wantedDevices {
+			if !knownDevices[device] {
+				change(DeviceAdded, room, device)
+			}
+		}
+		for device := range knownDevices {
+			if !wantedDevices[device] && !salted[room][device] {
+				change(DeviceRemoved, room, device)
+			}
+		}
+	}
+
+	for room, knownDevices := range known {
+		if _, ok := wanted[room]; ok {
+			continue
+		}
+
+		for device := range knownDevices {
+			if !salted[room][device] {
+				change(DeviceRemoved, room, device)
+			}
+		}
+		if len(salted[room]) == 0 {
+			change(RoomRemoved, room, "")
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Building != changes[j].Building {
+			return changes[i].Building < changes[j].Building
+		}
+		return changes[i].Room < changes[j].Room
+	})
+
+	for i := range changes {
+		changes[i].Time = time.Now()
+		log.Printf("Inventory: %s %s %s %s", changes[i].Change, changes[i].Building, changes[i].Room, changes[i].Device)
+
+		sink.Submit(pipeline.Event{
+			Source:    pipeline.SourceInventory,
+			Timestamp: changes[i].Time,
+			Building:  changes[i].Building,
+			Room:      changes[i].Room,
+			Device:    changes[i].Device,
+			Key:       pipeline.KeyInventory,
+			Value:     changes[i].Change,
+		})
+	}
+
+	return changes, nil
+}
+
+//returns inventory changes recorded at or after since, oldest first
+func GetChangelog(s Store, since time.Time) ([]ChangelogRecord, error) {
+
+	toReturn := []ChangelogRecord{}
+	err := s.Scan(Prefix(ChangelogClass), func(key, value []byte) error {
+		var record ChangelogRecord
+		err := Decode(value, &record)
+		if err != nil {
+			log.Printf("Error decoding %s: %s", key, err.Error())
+			return nil
+		}
+
+		if !record.Time.Before(since) {
+			toReturn = append(toReturn, record)
+		}
+		return nil
+	})
+
+	return toReturn, err
+}
+
+//writes or deletes the records an inventory notice affects, plus its changelog entry and event, in one batch.
+//a change the store already reflects, e.g. because two syncs found it, is skipped
+func applyInventory(s Store, event pipeline.Event) error {
+
+	var ops []Op
+	add := func(key []byte, record interface{}) error {
+		value, err := Encode(record)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, Op{Key: key, Value: value})
+		return nil
+	}
+
+	_, roomErr := GetRoom(s, event.Building, event.Room)
+	if roomErr != nil && roomErr != ErrNotFound {
+		return roomErr
+	}
+	_, deviceErr := GetDevice(s, event.Building, event.Room, event.Device)
+	if deviceErr != nil && deviceErr != ErrNotFound {
+		return deviceErr
+	}
+
+	var err error
+	switch event.Value {
+	case RoomAdded, RoomKnown:
+		if roomErr == nil {
+			return nil
+		}
+		//a placeholder until the reconciler polls it
+		err = add(RoomKey(event.Building, event.Room), RoomRecord{
+			Room:    base.PublicRoom{Building: event.Building, Room: event.Room},
+			Updated: time.Now(),
+			Source:  event.Source,
+		})
+	case DeviceAdded, DeviceKnown:
+		if deviceErr == nil {
+			return nil
+		}
+		err = add(DeviceKey(event.Building, event.Room, event.Device), DeviceRecord{
+			Building: event.Building,
+			Room:     event.Room,
+			Device:   event.Device,
+			Updated:  time.Now(),
+		})
+	case RoomRemoved:
+		if roomErr == ErrNotFound {
+			return nil
+		}
+		ops = append(ops, Op{Key: RoomKey(event.Building, event.Room), Delete: true})
+	case DeviceRemoved:
+		if deviceErr == ErrNotFound {
+			return nil
+		}
+		ops = append(ops, Op{Key: DeviceKey(event.Building, event.Room, event.Device), Delete: true})
+	default:
+		return putEvent(s, event)
+	}
+	if err != nil {
+		return err
+	}
+
+	if event.Value != RoomKnown && event.Value != DeviceKnown {
+		err = add(ChangelogKey(nextStamp()), ChangelogRecord{
+			Time:     event.Timestamp,
+			Change:   event.Value,
+			Building: event.Building,
+			Room:     event.Room,
+			Device:   event.Device,
+		})
+		if err == nil {
+			err = add(EventKey(event.Building, event.Room, nextStamp()), eventRecord(event))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Batch(ops)
+}
+
+//every room and its devices, according to the inventory. fails rather than returning a partial inventory
+func configuredInventory(p inventory.Provider) (map[RoomID]map[string]bool, error) {
+
+	configured := make(map[RoomID]map[string]bool)
+
+	buildings, err := p.Buildings()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, building := range buildings {
+		rooms, err := p.Rooms(building)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, room := range rooms {
+			devices, err := p.Devices(building, room)
+			if err != nil {
+				return nil, err
+			}
+
+			id := RoomID{Building: building, Room: room}
+			configured[id] = make(map[string]bool)
+			for _, device := range devices {
+				configured[id][device.Name] = true
+			}
+		}
+	}
+
+	return configured, nil
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+//building -> room -> devices
+type fakeInventory map[string]map[string][]string
+
+func (f fakeInventory) Buildings() ([]string, error) {
+	var buildings []string
+	for building := range f {
+		buildings = append(buildings, building)
+	}
+	sort.Strings(buildings)
+	return buildings, nil
+}
+
+func (f fakeInventory) Rooms(building string) ([]string, error) {
+	var rooms []string
+	for room := range f[building] {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms, nil
+}
+
+func (f fakeInventory) Devices(building, room string) ([]inventory.Device, error) {
+	devices, ok := f[building][room]
+	if !ok {
+		return nil, errors.New("no such room")
+	}
+
+	var toReturn []inventory.Device
+	for _, device := range devices {
+		toReturn = append(toReturn, inventory.Device{Name: device})
+	}
+	return toReturn, nil
+}
+
+func (f fakeInventory) Minions() (map[string]inventory.Location, error) {
+	return map[string]inventory.Location{}, nil
+}
+
+func changelog(t *testing.T, s Store) []ChangelogRecord {
+	records, err := GetChangelog(s, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestSyncInventory(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	p := fakeInventory{"ITB": {"1101": {"CP1", "D1"}}}
+
+	changes, err := SyncInventory(s, p, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 || changes[0].Change != RoomAdded {
+		t.Fatalf("got changes %+v, want the room and then its two devices added", changes)
+	}
+	if _, err := GetRoom(s, "ITB", "1101"); err != nil {
+		t.Errorf("room wasn't added: %v", err)
+	}
+	devices, _ := ListDevices(s, "ITB", "1101")
+	if len(devices) != 2 {
+		t.Errorf("got %d devices, want 2", len(devices))
+	}
+	if len(changelog(t, s)) != 3 {
+		t.Errorf("got %d changelog entries, want 3", len(changelog(t, s)))
+	}
+
+	//nothing changed
+	changes, err = SyncInventory(s, p, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got changes %+v syncing the same inventory again", changes)
+	}
+
+	p = fakeInventory{"ITB": {"1101": {"CP1"}, "1108": {}}}
+
+	changes, err = SyncInventory(s, p, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{DeviceRemoved + " D1", RoomAdded + " 1108"}
+	var got []string
+	for _, change := range changes {
+		if change.Device != "" {
+			got = append(got, change.Change+" "+change.Device)
+		} else {
+			got = append(got, change.Change+" "+change.Room)
+		}
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got changes %q, want %q", got, want)
+	}
+	if _, err := GetDevice(s, "ITB", "1101", "D1"); err != ErrNotFound {
+		t.Errorf("D1 wasn't removed: %v", err)
+	}
+
+	//an empty inventory is treated as an outage, not a reason to remove everything
+	_, err = SyncInventory(s, fakeInventory{}, sink)
+	if err == nil {
+		t.Errorf("syncing an empty inventory should fail")
+	}
+	rooms, _ := ListRooms(s, "")
+	if len(rooms) != 2 {
+		t.Errorf("got %d rooms after an empty inventory, want 2", len(rooms))
+	}
+}
+
+func TestSyncInventoryAfterStartup(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	room := RoomID{Building: "ITB", Room: "1101"}
+
+	//what OnStart submits for everything in the inventory
+	sink.Submit(known(RoomKnown, room, ""), known(DeviceKnown, room, "CP1"), known(DeviceKnown, room, "D1"))
+
+	if len(changelog(t, s)) != 0 {
+		t.Errorf("records known at startup shouldn't be logged as changes: %+v", changelog(t, s))
+	}
+
+	changes, err := SyncInventory(s, fakeInventory{"ITB": {"1101": {"CP1", "D1"}}}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got changes %+v, want none for devices seeded at startup", changes)
+	}
+}
+
+func TestApplyInventoryIsIdempotent(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	p := fakeInventory{"ITB": {"1101": {"CP1"}}}
+
+	//two syncs that both saw the same change, applied one after the other
+	first, err := SyncInventory(s, p, applySink{t, NewMemoryStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("got changes %+v, want 2", first)
+	}
+	for i := 0; i < 2; i++ {
+		for _, change := range first {
+			sink.Submit(known(change.Change, RoomID{Building: change.Building, Room: change.Room}, change.Device))
+		}
+	}
+
+	if len(changelog(t, s)) != 2 {
+		t.Errorf("got %d changelog entries, want a change applied twice to be logged once", len(changelog(t, s)))
+	}
+
+	//and a removal that's already happened doesn't bring anything back
+	removed := known(DeviceRemoved, RoomID{Building: "ITB", Room: "1101"}, "CP1")
+	sink.Submit(removed, removed)
+
+	if _, err := GetDevice(s, "ITB", "1101", "CP1"); err != ErrNotFound {
+		t.Errorf("CP1 wasn't removed: %v", err)
+	}
+	if len(changelog(t, s)) != 3 {
+		t.Errorf("got %d changelog entries, want 3", len(changelog(t, s)))
+	}
+}
+
+func TestSyncInventoryKeepsSaltDevices(t *testing.T) {
+	s := NewMemoryStore()
+	sink := applySink{t, s}
+
+	p := fakeInventory{"ITB": {"1101": {"CP1"}}}
+	_, err := SyncInventory(s, p, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//salt reports a device the inventory doesn't have, in a room it has and in one it doesn't
+	sink.Submit(event("D1", pipeline.KeyMinion, "ITB-1101-D1"), event("D1", pipeline.KeyOnline, "true"))
+	for _, salted := range []pipeline.Event{event("CP1", pipeline.KeyMinion, "ITB-1108-CP1"), event("CP1", pipeline.KeyOnline, "true")} {
+		salted.Room = "1108"
+		sink.Submit(salted)
+	}
+
+	changes, err := SyncInventory(s, p, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got changes %+v, want devices salt is hearing from left alone", changes)
+	}
+
+	//once salt has gone quiet they're removed
+	grace := SaltGrace
+	SaltGrace = 0
+	defer func() { SaltGrace = grace }()
+
+	changes, err = SyncInventory(s, p, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("got changes %+v, want both devices and ITB 1108 removed", changes)
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Every key in the store is a slash separated path. The first segment names the
+//record class, the rest identify the record:
+//
+//	room/<building>/<room>/state                RoomRecord
+//	device/<building>/<room>/<device>/state     DeviceRecord
+//	event/<building>/<room>/<timestamp>         EventRecord
+//	history/<building>/<room>/<timestamp>       HistoryRecord
+//	changelog/<timestamp>                       ChangelogRecord
+//	minion/<minion>/override                    MinionOverride
+//	alert/<type>/<building>/<room>[/<device>]   alerts.Alert, one per active alert
+//
+//Timestamps are nanoseconds since the epoch, zero padded to 20 digits so keys
+//sort chronologically. Building, room and device names must not contain a slash.
+//
+//Values are a single version byte followed by the record encoded with that
+//version. Version 1 is JSON.
+
+const (
+	RoomClass      = "room"
+	DeviceClass    = "device"
+	EventClass     = "event"
+	HistoryClass   = "history"
+	ChangelogClass = "changelog"
+	MinionClass    = "minion"
+	AlertClass     = "alert"
+)
+
+const EncodingVersion byte = 1
+
+var ErrUnknownEncoding = errors.New("value was written with an unknown encoding")
+
+func RoomKey(building, room string) []byte {
+	return []byte(RoomClass + "/" + building + "/" + room + "/state")
+}
+
+func DeviceKey(building, room, device string) []byte {
+	return []byte(DeviceClass + "/" + building + "/" + room + "/" + device + "/state")
+}
+
+func EventKey(building, room string, stamp time.Time) []byte {
+	return []byte(EventClass + "/" + building + "/" + room + "/" + FormatStamp(stamp))
+}
+
+func HistoryKey(building, room string, stamp time.Time) []byte {
+	return []byte(HistoryClass + "/" + building + "/" + room + "/" + FormatStamp(stamp))
+}
+
+func ChangelogKey(stamp time.Time) []byte {
+	return []byte(ChangelogClass + "/" + FormatStamp(stamp))
+}
+
+func MinionOverrideKey(minion string) []byte {
+	return []byte(MinionClass + "/" + minion + "/override")
+}
+
+//alert IDs are already slash separated paths
+func AlertKey(id string) []byte {
+	return []byte(AlertClass + "/" + id)
+}
+
+//builds the prefix that selects every key in a class below the given path segments, e.g. Prefix(DeviceClass, "ITB") matches every device in ITB
+func Prefix(class string, segments ...string) []byte {
+	return []byte(strings.Join(append([]string{class}, segments...), "/") + "/")
+}
+
+//splits a key into its class and remaining segments
+func SplitKey(key []byte) (string, []string) {
+	parts := strings.Split(string(key), "/")
+	return parts[0], parts[1:]
+}
+
+func FormatStamp(stamp time.Time) string {
+	return fmt.Sprintf("%020d", stamp.UnixNano())
+}
+
+func ParseStamp(stamp string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
+
+var lastStamp time.Time
+var stampMutex sync.Mutex
+
+//returns the current time, nudged forward if needed so no two calls return the same value. keeps timestamped keys from colliding
+func nextStamp() time.Time {
+	stampMutex.Lock()
+	defer stampMutex.Unlock()
+
+	now := time.Now()
+	if !now.After(lastStamp) {
+		now = lastStamp.Add(time.Nanosecond)
+	}
+	lastStamp = now
+	return now
+}
+
+//encodes a record with the current encoding version
+func Encode(record interface{}) ([]byte, error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{EncodingVersion}, b...), nil
+}
+
+//decodes a value written by Encode into record
+func Decode(value []byte, record interface{}) error {
+	if len(value) == 0 || value[0] != EncodingVersion {
+		return ErrUnknownEncoding
+	}
+	return json.Unmarshal(value[1:], record)
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//keeps everything in a map. nothing survives a restart
+type memoryStore struct {
+	watchers
+
+	mutex sync.RWMutex
+	data  map[string][]byte
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{data: make(map[string][]byte)}
+}
+
+func (m *memoryStore) Get(key []byte) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *memoryStore) Put(key, value []byte) error {
+	return m.Batch([]Op{{Key: key, Value: value}})
+}
+
+func (m *memoryStore) Delete(key []byte) error {
+	return m.Batch([]Op{{Key: key, Delete: true}})
+}
+
+func (m *memoryStore) Scan(prefix []byte, fn func(key, value []byte) error) error {
+
+	//copy out what we need so fn can write to the store
+	m.mutex.RLock()
+	var keys []string
+	for key := range m.data {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		values[key] = m.data[key]
+	}
+	m.mutex.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err := fn([]byte(key), append([]byte{}, values[key]...))
+		if err == ErrStopScan {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) Batch(ops []Op) error {
+	defer writeLatency.Since(time.Now())
+
+	m.mutex.Lock()
+	for _, op := range ops {
+		if op.Delete {
+			delete(m.data, string(op.Key))
+		} else {
+			m.data[string(op.Key)] = append([]byte{}, op.Value...)
+		}
+	}
+	m.notify(ops)
+	m.mutex.Unlock()
+
+	return nil
+}
+
+func (m *memoryStore) Watch(prefix []byte) (<-chan Change, func()) {
+	return m.watch(prefix)
+}
+
+func (m *memoryStore) Close() error {
+	m.closeAll()
+	return nil
+}
+
+func (m *memoryStore) Size() (int64, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var size int64
+	for key, value := range m.data {
+		size += int64(len(key) + len(value))
+	}
+	return size, nil
+}
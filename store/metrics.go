@@ -0,0 +1,9 @@
+package store
+
+import "github.com/byuoitav/monster-monitoring-service/metrics"
+
+var (
+	writeLatency = metrics.NewHistogram("monster_store_write_seconds", "How long writes to the store take.", nil)
+	pollLatency  = metrics.NewHistogram("monster_room_poll_seconds", "How long room polls against the av-api take, not counting time waiting on the rate limit.", nil)
+	pollErrors   = metrics.NewCounter("monster_room_poll_errors_total", "Room polls that failed, by reason (error or timeout).", "reason")
+)
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/minions"
+)
+
+//keeps minion overrides under MinionOverrideKey
+type overrideStore struct {
+	s Store
+}
+
+func MinionOverrides(s Store) minions.OverrideStore {
+	return overrideStore{s: s}
+}
+
+func (o overrideStore) LoadOverrides() (map[string]inventory.Location, error) {
+
+	toReturn := make(map[string]inventory.Location)
+	err := o.s.Scan(Prefix(MinionClass), func(key, value []byte) error {
+		var record MinionOverride
+		err := Decode(value, &record)
+		if err != nil {
+			return err
+		}
+
+		toReturn[record.Minion] = inventory.Location{Building: record.Building, Room: record.Room, Device: record.Device}
+		return nil
+	})
+
+	return toReturn, err
+}
+
+func (o overrideStore) SaveOverride(minion string, location inventory.Location) error {
+
+	value, err := Encode(MinionOverride{
+		Minion:   minion,
+		Building: location.Building,
+		Room:     location.Room,
+		Device:   location.Device,
+		Updated:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return o.s.Put(MinionOverrideKey(minion), value)
+}
+
+func (o overrideStore) DeleteOverride(minion string) error {
+	return o.s.Delete(MinionOverrideKey(minion))
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/supervisor"
+	"golang.org/x/time/rate"
+)
+
+//how many rooms are polled at once
+var PollWorkers = 16
+
+//caps polls across every worker, so a big sync doesn't flood the av-api
+var PollLimiter = rate.NewLimiter(rate.Limit(10), 5)
+
+//how long a single room poll can take before it's abandoned
+var PollTimeout = 30 * time.Second
+
+var ErrPollTimeout = errors.New("timed out polling room")
+
+type RoomID struct {
+	Building string `json:"building"`
+	Room     string `json:"room"`
+}
+
+//polls a room through the rate limiter, giving up after PollTimeout or when ctx is canceled
+func pollRoom(ctx context.Context, building, room string) (base.PublicRoom, error) {
+
+	err := PollLimiter.Wait(ctx)
+	if err != nil {
+		return base.PublicRoom{}, err
+	}
+
+	type result struct {
+		room base.PublicRoom
+		err  error
+	}
+
+	start := time.Now()
+
+	//the av-api call can't be canceled, so a timed out poll is left to finish on its own
+	results := make(chan result, 1)
+	go func() {
+		var status base.PublicRoom
+		err := supervisor.Recover(func() error {
+			var err error
+			status, err = PollRoom(building, room)
+			return err
+		})
+		results <- result{room: status, err: err}
+	}()
+
+	select {
+	case res := <-results:
+		pollLatency.Since(start)
+		if res.err != nil {
+			pollErrors.Inc("error")
+		}
+		return res.room, res.err
+	case <-time.After(PollTimeout):
+		pollLatency.Since(start)
+		pollErrors.Inc("timeout")
+		return base.PublicRoom{}, ErrPollTimeout
+	case <-ctx.Done():
+		return base.PublicRoom{}, ctx.Err()
+	}
+}
+
+//runs fn for every room on PollWorkers goroutines and waits for them all to finish. rooms not started by the time ctx is canceled are skipped.
+//a panic in fn is recovered, and the first one is returned once every room is done
+func forEachRoom(ctx context.Context, rooms []RoomID, fn func(RoomID)) error {
+
+	queue := make(chan RoomID)
+	var workers sync.WaitGroup
+
+	var panicked error
+	var panicMutex sync.Mutex
+
+	for i := 0; i < PollWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for room := range queue {
+				room := room
+				err := supervisor.Recover(func() error {
+					fn(room)
+					return nil
+				})
+				if err != nil {
+					panicMutex.Lock()
+					if panicked == nil {
+						panicked = fmt.Errorf("%s %s: %s", room.Building, room.Room, err.Error())
+					}
+					panicMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, room := range rooms {
+		select {
+		case queue <- room:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+
+	workers.Wait()
+	return panicked
+}
+
+//how far along the startup sync is. a building whose rooms couldn't be read counts as a single failed room
+type SyncProgress struct {
+	Total    int       `json:"total"`
+	Done     int       `json:"done"`
+	Failed   int       `json:"failed"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Complete bool      `json:"complete"`
+}
+
+var progress SyncProgress
+var progressMutex sync.RWMutex
+
+func Progress() SyncProgress {
+	progressMutex.RLock()
+	defer progressMutex.RUnlock()
+
+	return progress
+}
+
+func startProgress(total int) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	progress = SyncProgress{Total: total, Started: time.Now()}
+}
+
+//counts a finished room and logs every tenth of the way through
+func advanceProgress(failed bool) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	progress.Done++
+	if failed {
+		progress.Failed++
+	}
+
+	step := progress.Total / 10
+	if step == 0 || progress.Done%step == 0 || progress.Done == progress.Total {
+		log.Printf("Initial sync: %d of %d rooms polled (%d failed)", progress.Done, progress.Total, progress.Failed)
+	}
+}
+
+func finishProgress() {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	progress.Finished = time.Now()
+	progress.Complete = true
+}
+
+//for the readiness check: fails until the initial sync is done
+func SyncReady() (time.Time, error) {
+	finished := Progress()
+	if !finished.Complete {
+		return time.Time{}, fmt.Errorf("initial sync has polled %d of %d rooms", finished.Done, finished.Total)
+	}
+	return finished.Finished, nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/av-api/status"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+)
+
+//how often every stored room is polled and compared against the av-api
+var ReconcileInterval = 15 * time.Minute
+
+//fetches a room's status from the av-api. calls go through pollRoom so they're rate limited
+var PollRoom = status.GetRoomStatus
+
+//what a reconcile found for one room
+type ReconcileReport struct {
+	Building      string          `json:"building"`
+	Room          string          `json:"room"`
+	Discrepancies []HistoryRecord `json:"discrepancies"`
+	Error         string          `json:"error,omitempty"`
+}
+
+//reconciles every stored room each ReconcileInterval until ctx is canceled. returns the error if a pass can't be made
+func RunReconciler(ctx context.Context, s Store, sink pipeline.Sink) error {
+
+	log.Printf("Reconciling rooms against the av-api every %s...", ReconcileInterval)
+
+	ticker := time.NewTicker(ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Stopping reconciler")
+			return nil
+		case <-ticker.C:
+			reports, err := ReconcileBuilding(ctx, s, sink, "")
+			if err != nil {
+				return fmt.Errorf("error reconciling rooms: %s", err.Error())
+			}
+
+			drifted := 0
+			for _, report := range reports {
+				if len(report.Discrepancies) > 0 {
+					drifted++
+				}
+			}
+			log.Printf("Reconciled %d rooms. %d had drifted", len(reports), drifted)
+		}
+	}
+}
+
+//reconciles every stored room in a building, or in every building if building is empty
+func ReconcileBuilding(ctx context.Context, s Store, sink pipeline.Sink, building string) ([]ReconcileReport, error) {
+
+	rooms, err := ListRooms(s, building)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []RoomID
+	for _, room := range rooms {
+		ids = append(ids, RoomID{Building: room.Room.Building, Room: room.Room.Room})
+	}
+
+	var mutex sync.Mutex
+	reports := []ReconcileReport{}
+
+	err = forEachRoom(ctx, ids, func(room RoomID) {
+		report, _ := ReconcileRoom(ctx, s, sink, room.Building, room.Room)
+
+		mutex.Lock()
+		reports = append(reports, report)
+		mutex.Unlock()
+	})
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Building != reports[j].Building {
+			return reports[i].Building < reports[j].Building
+		}
+		return reports[i].Room < reports[j].Room
+	})
+
+	return reports, err
+}
+
+//polls a room and sends anything that differs from what we have stored, as discrepancy notices, and the polled state down the pipeline.
+//every room that could be polled is marked verified, drifted or not
+func ReconcileRoom(ctx context.Context, s Store, sink pipeline.Sink, building, room string) (ReconcileReport, error) {
+
+	report := ReconcileReport{
+		Building:      building,
+		Room:          room,
+		Discrepancies: []HistoryRecord{},
+	}
+
+	polled, err := pollRoom(ctx, building, room)
+	if err != nil {
+		log.Printf("Error polling room: %s in building: %s: %s", room, building, err.Error())
+		report.Error = err.Error()
+		return report, err
+	}
+
+	stored, err := GetRoom(s, building, room)
+	if err != nil && err != ErrNotFound {
+		report.Error = err.Error()
+		return report, err
+	}
+
+	report.Discrepancies = diff(building, room, pipeline.SourceReconcile, flattenRoom(stored.Room), flattenRoom(polled))
+	if len(report.Discrepancies) == 0 {
+		sink.Submit(pipeline.Verified(building, room, pipeline.SourceReconcile))
+		return report, nil
+	}
+
+	log.Printf("Room %s in building %s drifted in %d fields. Correcting...", room, building, len(report.Discrepancies))
+
+	var events []pipeline.Event
+	for _, discrepancy := range report.Discrepancies {
+		events = append(events, pipeline.Event{
+			Source:    pipeline.SourceReconcile,
+			Timestamp: time.Now(),
+			Building:  building,
+			Room:      room,
+			Device:    discrepancy.Device,
+			Key:       pipeline.KeyDiscrepancy,
+			Value:     fmt.Sprintf("%s: stored %q, polled %q", discrepancy.Key, discrepancy.Old, discrepancy.New),
+		})
+	}
+
+	//anything the av-api stopped reporting is cleared, not just left as it was
+	events = append(events, pipeline.FromRoom(polled, pipeline.SourceReconcile)...)
+	events = append(events, pipeline.Clears(stored.Room, polled, pipeline.SourceReconcile)...)
+	events = append(events, pipeline.Verified(building, room, pipeline.SourceReconcile))
+
+	sink.Submit(events...)
+
+	return report, nil
+}
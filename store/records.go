@@ -0,0 +1,61 @@
+package store
+
+import (
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+)
+
+//stored under RoomKey: the latest status plus when and where it came from
+type RoomRecord struct {
+	Room    base.PublicRoom `json:"room"`
+	Updated time.Time       `json:"updated"`
+	Source  string          `json:"source"` //one of the pipeline sources
+}
+
+//stored under DeviceKey
+type DeviceRecord struct {
+	Building string            `json:"building"`
+	Room     string            `json:"room"`
+	Device   string            `json:"device"`
+	Minion   string            `json:"minion,omitempty"`
+	Online   bool              `json:"online"`
+	LastSeen time.Time         `json:"lastSeen,omitempty"`
+	LastJob  *JobResult        `json:"lastJob,omitempty"`
+	State    map[string]string `json:"state,omitempty"`
+	Updated  time.Time         `json:"updated"`
+}
+
+//only salt reports whether a device is online, so devices it doesn't manage are never offline as far as we know
+func (d DeviceRecord) Offline() bool {
+	return len(d.Minion) > 0 && !d.Online
+}
+
+//the outcome of the most recent salt job to return from a device
+type JobResult struct {
+	JID      string    `json:"jid"`
+	Function string    `json:"function"`
+	Success  bool      `json:"success"`
+	RetCode  int       `json:"retcode"`
+	Time     time.Time `json:"time"`
+}
+
+//stored under EventKey, one per notice that came through the pipeline
+type EventRecord struct {
+	Building string    `json:"building"`
+	Room     string    `json:"room"`
+	Device   string    `json:"device,omitempty"`
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+}
+
+//stored under MinionOverrideKey, one per minion pinned to a device through the API
+type MinionOverride struct {
+	Minion   string    `json:"minion"`
+	Building string    `json:"building"`
+	Room     string    `json:"room"`
+	Device   string    `json:"device"`
+	Updated  time.Time `json:"updated"`
+}
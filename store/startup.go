@@ -1,46 +1,104 @@
 package store
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"time"
 
-	"github.com/byuoitav/av-api/dbo"
-	"github.com/byuoitav/av-api/status"
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
 )
 
-func OnStart() {
+//polls every room in the inventory and sends its status down the pipeline. Progress reports how far along it is.
+//failing to list the buildings returns an error to be retried. a building whose rooms can't be read is counted as failed, and a room whose devices can't be read is still polled
+func OnStart(ctx context.Context, s Store, p inventory.Provider, sink pipeline.Sink) error {
 
 	log.Printf("Querying buildings...")
 
-	buildings, err := dbo.GetBuildings()
+	buildings, err := p.Buildings()
 	if err != nil {
-		log.Printf("Error getting buildings from database: %s", err.Error())
+		return fmt.Errorf("error getting buildings from inventory: %s", err.Error())
 	}
 
+	var rooms []RoomID
+	var unread []string
+
 	for _, building := range buildings {
 
-		log.Printf("Getting rooms from building %s...", building.Name)
-		rooms, err := dbo.GetRoomsByBuilding(building.Name)
+		log.Printf("Getting rooms from building %s...", building)
+		buildingRooms, err := p.Rooms(building)
 		if err != nil {
-			log.Printf("Error getting rooms from %s: %s", building.Name, err.Error())
+			log.Printf("Error getting rooms from %s: %s", building, err.Error())
+			unread = append(unread, building)
+			continue
 		}
 
-		for _, room := range rooms {
+		for _, room := range buildingRooms {
+			rooms = append(rooms, RoomID{Building: building, Room: room})
+		}
+	}
 
-			log.Printf("Getting status of room %s...", room.Name)
-			roomStatus, err := status.GetRoomStatus(building.Name, room.Name)
-			if err != nil {
-				log.Printf("Error getting status for room: %s in building %s: %s", building.Name, room.Name, err.Error())
-			}
+	log.Printf("Polling %d rooms with %d workers...", len(rooms), PollWorkers)
+	startProgress(len(rooms) + len(unread))
+	for range unread {
+		advanceProgress(true)
+	}
 
-			log.Printf("Adding room %s to Badger...", room.Name)
-			err = UpdateStoreByRoom(roomStatus)
-			if err != nil {
-				log.Printf("Error adding room: %s in building: %s to Badger: %s", building.Name, room.Name, err.Error())
-			}
+	//records for everything in the inventory, so the reconciler picks rooms up even if they can't be polled now
+	for _, room := range rooms {
+		sink.Submit(known(RoomKnown, room, ""))
 
+		devices, err := p.Devices(room.Building, room.Room)
+		if err != nil {
+			log.Printf("Error getting devices in %s %s: %s", room.Building, room.Room, err.Error())
+			continue
 		}
 
+		for _, device := range devices {
+			sink.Submit(known(DeviceKnown, room, device.Name))
+		}
 	}
 
-	return
+	err = forEachRoom(ctx, rooms, func(room RoomID) {
+
+		roomStatus, err := pollRoom(ctx, room.Building, room.Room)
+		if err != nil {
+			log.Printf("Error getting status for room: %s in building %s: %s", room.Room, room.Building, err.Error())
+			advanceProgress(true)
+			return
+		}
+
+		sink.Submit(pipeline.FromRoom(roomStatus, pipeline.SourceAVAPI)...)
+		sink.Submit(pipeline.Verified(room.Building, room.Room, pipeline.SourceAVAPI))
+
+		advanceProgress(false)
+	})
+
+	if ctx.Err() != nil {
+		log.Printf("Shutting down. Abandoning initial sync")
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error polling rooms: %s", err.Error())
+	}
+
+	finishProgress()
+
+	finished := Progress()
+	log.Printf("Initial sync finished in %s", finished.Finished.Sub(finished.Started).Round(time.Millisecond))
+
+	return nil
+}
+
+func known(kind string, room RoomID, device string) pipeline.Event {
+	return pipeline.Event{
+		Source:    pipeline.SourceInventory,
+		Timestamp: time.Now(),
+		Building:  room.Building,
+		Room:      room.Room,
+		Device:    device,
+		Key:       pipeline.KeyInventory,
+		Value:     kind,
+	}
 }
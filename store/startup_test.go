@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/inventory"
+)
+
+//an inventory where some buildings' rooms, and some rooms' devices, can't be read
+type brokenInventory struct {
+	fakeInventory
+	broken map[string]bool
+}
+
+func (b brokenInventory) Rooms(building string) ([]string, error) {
+	if b.broken[building] {
+		return nil, errors.New("building unavailable")
+	}
+	return b.fakeInventory.Rooms(building)
+}
+
+func (b brokenInventory) Devices(building, room string) ([]inventory.Device, error) {
+	if b.broken[building+"-"+room] {
+		return nil, errors.New("room unavailable")
+	}
+	return b.fakeInventory.Devices(building, room)
+}
+
+func TestOnStartSkipsUnreadableInventory(t *testing.T) {
+	poll := PollRoom
+	PollRoom = func(building, room string) (base.PublicRoom, error) {
+		return base.PublicRoom{Building: building, Room: room}, nil
+	}
+	defer func() { PollRoom = poll }()
+
+	s := NewMemoryStore()
+	p := brokenInventory{
+		fakeInventory: fakeInventory{
+			"ITB":  {"1101": {"CP1"}, "1108": {"CP1"}},
+			"JFSB": {"B203": {"CP1"}},
+		},
+		broken: map[string]bool{"JFSB": true, "ITB-1108": true},
+	}
+
+	err := OnStart(context.Background(), s, p, applySink{t, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := Progress()
+	if !progress.Complete {
+		t.Errorf("the sync should finish despite parts of the inventory being unreadable")
+	}
+	if progress.Total != 3 || progress.Done != 3 || progress.Failed != 1 {
+		t.Errorf("got progress %+v, want 3 done with the unreadable building failed", progress)
+	}
+
+	//a room whose devices couldn't be listed is still known
+	rooms, err := ListRooms(s, "ITB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 {
+		t.Errorf("got %d rooms in ITB, want 2", len(rooms))
+	}
+}
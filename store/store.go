@@ -0,0 +1,141 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+//the key/value operations everything else in this package is built on. Badger backs it in production, memory in tests and local runs
+type Store interface {
+	//returns ErrNotFound if nothing is stored under key
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	//calls fn for every key starting with prefix, in key order. returning ErrStopScan from fn ends the scan early without an error
+	Scan(prefix []byte, fn func(key, value []byte) error) error
+
+	//applies every op, in order
+	Batch(ops []Op) error
+
+	//delivers every change to a key starting with prefix until cancel is called
+	Watch(prefix []byte) (changes <-chan Change, cancel func())
+
+	//roughly how many bytes the store takes up
+	Size() (int64, error)
+
+	Close() error
+}
+
+//a single write in a batch
+type Op struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+//a write seen by a watcher
+type Change struct {
+	Key     []byte
+	Value   []byte
+	Deleted bool
+}
+
+//returned when a record has never been written to the store
+var ErrNotFound = errors.New("record not found")
+
+var ErrStopScan = errors.New("stop scan")
+
+var ErrClosed = errors.New("store is closed")
+
+//checks that the store can still be read. fails once it's been closed
+func Ping(s Store) error {
+	_, err := s.Get([]byte("ping"))
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+//how many changes a watcher can fall behind before changes are dropped for it
+var WatchBuffer = 1024
+
+//fans changes out to watchers. shared by every Store implementation
+type watchers struct {
+	mutex    sync.RWMutex
+	watching map[*watcher]bool
+}
+
+type watcher struct {
+	prefix  []byte
+	changes chan Change
+	dropped int64 //updated atomically, since notify only holds the read lock
+}
+
+func (w *watchers) watch(prefix []byte) (<-chan Change, func()) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.watching == nil {
+		w.watching = make(map[*watcher]bool)
+	}
+
+	watcher := &watcher{
+		prefix:  append([]byte{}, prefix...),
+		changes: make(chan Change, WatchBuffer),
+	}
+	w.watching[watcher] = true
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+
+			//closeAll may have beaten us to it
+			if w.watching[watcher] {
+				delete(w.watching, watcher)
+				close(watcher.changes)
+			}
+		})
+	}
+
+	return watcher.changes, cancel
+}
+
+//never blocks the writer. a watcher that can't keep up loses changes.
+//stores call it before releasing their write lock, so watchers see batches in the order they were committed
+func (w *watchers) notify(ops []Op) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	for watcher := range w.watching {
+		for _, op := range ops {
+			if !bytes.HasPrefix(op.Key, watcher.prefix) {
+				continue
+			}
+
+			select {
+			case watcher.changes <- Change{Key: op.Key, Value: op.Value, Deleted: op.Delete}:
+			default:
+				dropped := atomic.AddInt64(&watcher.dropped, 1)
+				if dropped%100 == 1 {
+					log.Printf("Watcher on %s is falling behind. %d changes dropped", watcher.prefix, dropped)
+				}
+			}
+		}
+	}
+}
+
+func (w *watchers) closeAll() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for watcher := range w.watching {
+		close(watcher.changes)
+	}
+	w.watching = nil
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//the last change a watcher sees for a key is what ends up stored, however the writes race
+func TestWatchOrder(t *testing.T) {
+	s := NewMemoryStore()
+
+	changes, cancel := s.Watch(Prefix(RoomClass))
+	defer cancel()
+
+	key := RoomKey("ITB", "1101")
+
+	var writers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			for j := 0; j < 50; j++ {
+				s.Put(key, []byte(strconv.Itoa(i*100+j)))
+			}
+		}(i)
+	}
+	writers.Wait()
+
+	var last Change
+	for len(changes) > 0 {
+		last = <-changes
+	}
+
+	stored, err := s.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(last.Value) != string(stored) {
+		t.Errorf("last change seen was %s, but %s is stored", last.Value, stored)
+	}
+}
+
+func TestWatchDropsWhenBehind(t *testing.T) {
+	buffer := WatchBuffer
+	WatchBuffer = 4
+	defer func() { WatchBuffer = buffer }()
+
+	s := NewMemoryStore()
+
+	changes, cancel := s.Watch(Prefix(RoomClass))
+	defer cancel()
+
+	//writers never wait on a watcher that isn't reading
+	var writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			for j := 0; j < 25; j++ {
+				s.Put(RoomKey("ITB", strconv.Itoa(i)), []byte("{}"))
+			}
+		}(i)
+	}
+	writers.Wait()
+
+	if len(changes) != 4 {
+		t.Errorf("got %d buffered changes, want 4", len(changes))
+	}
+}
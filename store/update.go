@@ -0,0 +1,167 @@
+package store
+
+import (
+	"bytes"
+	"log"
+	"time"
+)
+
+//returns the latest record for a room, or ErrNotFound if the room has never been stored
+func GetRoom(s Store, building, room string) (RoomRecord, error) {
+
+	var record RoomRecord
+	err := get(s, RoomKey(building, room), &record)
+	return record, err
+}
+
+//returns the records for every room in a building, or in every building if building is empty
+func ListRooms(s Store, building string) ([]RoomRecord, error) {
+
+	prefix := Prefix(RoomClass)
+	if len(building) > 0 {
+		prefix = Prefix(RoomClass, building)
+	}
+
+	toReturn := []RoomRecord{}
+	err := s.Scan(prefix, func(key, value []byte) error {
+		var record RoomRecord
+		err := Decode(value, &record)
+		if err != nil {
+			log.Printf("Error decoding %s: %s", key, err.Error())
+			return nil
+		}
+
+		toReturn = append(toReturn, record)
+		return nil
+	})
+
+	return toReturn, err
+}
+
+//returns the records for every device in a room, every room in a building if room is empty, or everywhere if both are empty
+func ListDevices(s Store, building, room string) ([]DeviceRecord, error) {
+
+	var segments []string
+	if len(building) > 0 {
+		segments = append(segments, building)
+		if len(room) > 0 {
+			segments = append(segments, room)
+		}
+	}
+
+	toReturn := []DeviceRecord{}
+	err := s.Scan(Prefix(DeviceClass, segments...), func(key, value []byte) error {
+		var record DeviceRecord
+		err := Decode(value, &record)
+		if err != nil {
+			log.Printf("Error decoding %s: %s", key, err.Error())
+			return nil
+		}
+
+		toReturn = append(toReturn, record)
+		return nil
+	})
+
+	return toReturn, err
+}
+
+//returns the latest record for a device, or ErrNotFound if we've never heard of it
+func GetDevice(s Store, building, room, device string) (DeviceRecord, error) {
+
+	var record DeviceRecord
+	err := get(s, DeviceKey(building, room, device), &record)
+	return record, err
+}
+
+//applies update to the stored record for a device, creating the record if needed. a record the update doesn't change isn't written again
+func updateDevice(s Store, source, building, room, device string, update func(*DeviceRecord)) error {
+
+	record, err := GetDevice(s, building, room, device)
+	existed := err == nil
+	if err == ErrNotFound {
+		record = DeviceRecord{
+			Building: building,
+			Room:     room,
+			Device:   device,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	before := flattenDevice(record)
+	original, err := Encode(record)
+	if err != nil {
+		return err
+	}
+
+	//update may touch the state map, so give it its own copy
+	state := make(map[string]string, len(record.State))
+	for key, value := range record.State {
+		state[key] = value
+	}
+	record.State = state
+
+	update(&record)
+
+	if existed {
+		updated, err := Encode(record)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(original, updated) {
+			return nil
+		}
+	}
+	record.Updated = time.Now()
+
+	changes := diff(building, room, source, before, flattenDevice(record))
+
+	return putWithHistory(s, DeviceKey(building, room, device), record, changes)
+}
+
+//writes a record and the history of what changed in it in one batch
+func putWithHistory(s Store, key []byte, record interface{}, changes []HistoryRecord) error {
+
+	value, err := Encode(record)
+	if err != nil {
+		log.Printf("Error encoding %s: %s", key, err.Error())
+		return err
+	}
+
+	ops, err := historyOps(changes)
+	if err != nil {
+		log.Printf("Error encoding history for %s: %s", key, err.Error())
+		return err
+	}
+
+	return s.Batch(append([]Op{{Key: key, Value: value}}, ops...))
+}
+
+//reads and decodes the record stored under key
+func get(s Store, key []byte, record interface{}) error {
+
+	value, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+
+	err = Decode(value, record)
+	if err != nil {
+		log.Printf("Error decoding %s: %s", key, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+//encodes record and stores it under key, replacing whatever was there
+func put(s Store, key []byte, record interface{}) error {
+
+	value, err := Encode(record)
+	if err != nil {
+		log.Printf("Error encoding %s: %s", key, err.Error())
+		return err
+	}
+
+	return s.Put(key, value)
+}
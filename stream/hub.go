@@ -0,0 +1,311 @@
+//streams room and device state changes to dashboards as they're stored
+package stream
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/av-api/base"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//how many messages can wait for a subscriber before it's considered too slow and dropped
+var SendBuffer = 256
+
+//the most changes a reconnecting client is replayed, and the longest it can have been gone. past either it gets a new snapshot instead
+var (
+	ReplayLimit  = 1000
+	ReplayMaxAge = 1 * time.Hour
+)
+
+//returned by Replay when the client missed too much to catch up change by change
+var ErrReplayTooLong = errors.New("too much to replay")
+
+//message types
+const (
+	SnapshotMessage = "snapshot"
+	ChangeMessage   = "change"
+)
+
+//what subscribers are sent: one snapshot of everything their filter matches, then each change as it's stored
+type Message struct {
+	Type    string               `json:"type"`
+	ID      string               `json:"id,omitempty"`
+	Rooms   []store.RoomRecord   `json:"rooms,omitempty"`
+	Devices []store.DeviceRecord `json:"devices,omitempty"`
+	Change  *store.HistoryRecord `json:"change,omitempty"`
+}
+
+//fans stored changes out to subscribers
+type Hub struct {
+	store store.Store
+
+	mutex       sync.RWMutex
+	subscribers map[*Subscription]bool
+}
+
+func NewHub(s store.Store) *Hub {
+	return &Hub{
+		store:       s,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+//one subscriber's view of the hub
+type Subscription struct {
+	hub      *Hub
+	messages chan Message
+
+	mutex  sync.RWMutex
+	filter Filter
+	slow   bool
+}
+
+//the subscription's messages are buffered, but if the buffer fills the subscription is dropped and Messages is closed
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+
+	subscription := &Subscription{
+		hub:      h,
+		messages: make(chan Message, SendBuffer),
+		filter:   filter,
+	}
+
+	h.mutex.Lock()
+	h.subscribers[subscription] = true
+	h.mutex.Unlock()
+
+	return subscription
+}
+
+//how many subscribers the hub has right now
+func (h *Hub) Count() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.subscribers)
+}
+
+//the current state of every room and device the filter matches
+func (h *Hub) Snapshot(filter Filter) (Message, error) {
+
+	snapshot := Message{
+		Type:    SnapshotMessage,
+		Rooms:   []store.RoomRecord{},
+		Devices: []store.DeviceRecord{},
+	}
+
+	rooms, err := store.ListRooms(h.store, "")
+	if err != nil {
+		return snapshot, err
+	}
+	for _, room := range rooms {
+		if filter.Match(room.Room.Building, room.Room.Room, "") {
+			snapshot.Rooms = append(snapshot.Rooms, room)
+			continue
+		}
+
+		//display and audio state lives in the room record, so a filter for devices gets the room with just those entries
+		if narrowed, ok := matchingDevices(filter, room); ok {
+			snapshot.Rooms = append(snapshot.Rooms, narrowed)
+		}
+	}
+
+	devices, err := store.ListDevices(h.store, "", "")
+	if err != nil {
+		return snapshot, err
+	}
+	for _, device := range devices {
+		if filter.Match(device.Building, device.Room, device.Device) {
+			snapshot.Devices = append(snapshot.Devices, device)
+		}
+	}
+
+	return snapshot, nil
+}
+
+//a copy of room holding only the displays and audio devices the filter matches, with none of the room-wide fields. false if it matches none
+func matchingDevices(filter Filter, room store.RoomRecord) (store.RoomRecord, bool) {
+
+	narrowed := room
+	narrowed.Room = base.PublicRoom{Building: room.Room.Building, Room: room.Room.Room}
+
+	for _, display := range room.Room.Displays {
+		if filter.Match(room.Room.Building, room.Room.Room, display.Name) {
+			narrowed.Room.Displays = append(narrowed.Room.Displays, display)
+		}
+	}
+	for _, audio := range room.Room.AudioDevices {
+		if filter.Match(room.Room.Building, room.Room.Room, audio.Name) {
+			narrowed.Room.AudioDevices = append(narrowed.Room.AudioDevices, audio)
+		}
+	}
+
+	return narrowed, len(narrowed.Room.Displays) > 0 || len(narrowed.Room.AudioDevices) > 0
+}
+
+//every stored change the filter matches since the change with ID after, oldest first.
+//returns ErrReplayTooLong if after is older than ReplayMaxAge or more than ReplayLimit changes match, without reading past the limit
+func (h *Hub) Replay(filter Filter, after string) ([]Message, error) {
+
+	since, err := store.ParseStamp(after)
+	if err != nil || time.Since(since) > ReplayMaxAge {
+		return nil, ErrReplayTooLong
+	}
+
+	messages := []Message{}
+	err = h.store.Scan(filter.prefix(), func(key, value []byte) error {
+		_, segments := store.SplitKey(key)
+		id := segments[len(segments)-1]
+		if id <= after {
+			return nil
+		}
+
+		var record store.HistoryRecord
+		err := store.Decode(value, &record)
+		if err != nil {
+			log.Printf("Error decoding %s: %s", key, err.Error())
+			return nil
+		}
+
+		if !filter.Match(record.Building, record.Room, record.Device) {
+			return nil
+		}
+		if len(messages) == ReplayLimit {
+			return ErrReplayTooLong
+		}
+
+		messages = append(messages, Message{Type: ChangeMessage, ID: id, Change: &record})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//history is only in time order within a room
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+
+	return messages, nil
+}
+
+//sends every change stored to the subscribers that want it until ctx is canceled
+func (h *Hub) Run(ctx context.Context) {
+
+	log.Printf("Streaming state changes...")
+
+	changes, cancel := h.store.Watch(store.Prefix(store.HistoryClass))
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Shutting down. Closing %d subscriptions", h.Count())
+			h.closeAll()
+			return
+
+		case change, ok := <-changes:
+			if !ok {
+				h.closeAll()
+				return
+			}
+			if change.Deleted {
+				continue
+			}
+
+			var record store.HistoryRecord
+			err := store.Decode(change.Value, &record)
+			if err != nil {
+				log.Printf("Error decoding %s: %s", change.Key, err.Error())
+				continue
+			}
+
+			_, segments := store.SplitKey(change.Key)
+			h.broadcast(Message{
+				Type:   ChangeMessage,
+				ID:     segments[len(segments)-1],
+				Change: &record,
+			})
+		}
+	}
+}
+
+func (h *Hub) broadcast(message Message) {
+
+	change := message.Change
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for subscription := range h.subscribers {
+		if !subscription.Filter().Match(change.Building, change.Room, change.Device) {
+			continue
+		}
+
+		select {
+		case subscription.messages <- message:
+		default:
+			log.Printf("Subscriber fell %d messages behind. Dropping it", SendBuffer)
+			subscription.mutex.Lock()
+			subscription.slow = true
+			subscription.mutex.Unlock()
+			h.remove(subscription)
+		}
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for subscription := range h.subscribers {
+		h.remove(subscription)
+	}
+}
+
+//must hold h.mutex
+func (h *Hub) remove(subscription *Subscription) {
+	if h.subscribers[subscription] {
+		delete(h.subscribers, subscription)
+		close(subscription.messages)
+	}
+}
+
+//closed when the subscription ends, whether the subscriber closed it, it was too slow, or the hub stopped
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *Subscription) Filter() Filter {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.filter
+}
+
+//changes what the subscription matches from now on
+func (s *Subscription) SetFilter(filter Filter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.filter = filter
+}
+
+//whether the hub dropped the subscription for falling behind
+func (s *Subscription) Slow() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.slow
+}
+
+func (s *Subscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+
+	s.hub.remove(s)
+}
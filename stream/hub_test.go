@@ -0,0 +1,208 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/sse"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//stores a change to room's power at stamp and returns its ID
+func change(t *testing.T, s store.Store, building, room string, stamp time.Time) string {
+	value, err := store.Encode(store.HistoryRecord{Time: stamp, Building: building, Room: room, Key: "power", New: "on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put(store.HistoryKey(building, room, stamp), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.FormatStamp(stamp)
+}
+
+func filter(t *testing.T, patterns ...string) Filter {
+	f, err := ParseFilter(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func ids(messages []Message) []string {
+	var toReturn []string
+	for _, message := range messages {
+		toReturn = append(toReturn, message.ID)
+	}
+	return toReturn
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplay(t *testing.T) {
+	s := store.NewMemoryStore()
+	h := NewHub(s)
+
+	now := time.Now()
+	first := change(t, s, "ITB", "1101", now.Add(-4*time.Minute))
+	second := change(t, s, "ITB", "1108", now.Add(-3*time.Minute))
+	third := change(t, s, "ITB", "1101", now.Add(-2*time.Minute))
+	change(t, s, "JFSB", "B203", now.Add(-1*time.Minute))
+
+	//in ID order across rooms, without what the client already has or what the filter doesn't match
+	missed, err := h.Replay(filter(t, "ITB"), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{second, third}; !equal(ids(missed), want) {
+		t.Errorf("replayed %v, want %v", ids(missed), want)
+	}
+}
+
+func TestReplayTooLong(t *testing.T) {
+	limit := ReplayLimit
+	ReplayLimit = 2
+	defer func() { ReplayLimit = limit }()
+
+	s := store.NewMemoryStore()
+	h := NewHub(s)
+
+	now := time.Now()
+	first := change(t, s, "ITB", "1101", now.Add(-4*time.Minute))
+	second := change(t, s, "ITB", "1101", now.Add(-3*time.Minute))
+	change(t, s, "ITB", "1101", now.Add(-2*time.Minute))
+	change(t, s, "ITB", "1101", now.Add(-1*time.Minute))
+
+	if _, err := h.Replay(nil, first); err != ErrReplayTooLong {
+		t.Errorf("replaying 3 changes with a limit of 2 got %v, want ErrReplayTooLong", err)
+	}
+	if missed, err := h.Replay(nil, second); err != nil || len(missed) != 2 {
+		t.Errorf("replaying 2 changes with a limit of 2 got %d, %v", len(missed), err)
+	}
+
+	//a client gone longer than ReplayMaxAge starts over, however little changed
+	gone := store.FormatStamp(now.Add(-ReplayMaxAge - time.Minute))
+	if _, err := h.Replay(nil, gone); err != ErrReplayTooLong {
+		t.Errorf("replaying from before ReplayMaxAge got %v, want ErrReplayTooLong", err)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	buffer := SendBuffer
+	SendBuffer = 1
+	defer func() { SendBuffer = buffer }()
+
+	h := NewHub(store.NewMemoryStore())
+
+	subscription := h.Subscribe(filter(t, "ITB/1101"))
+	h.broadcast(Message{Type: ChangeMessage, ID: "1", Change: &store.HistoryRecord{Building: "ITB", Room: "1108"}})
+	h.broadcast(Message{Type: ChangeMessage, ID: "2", Change: &store.HistoryRecord{Building: "ITB", Room: "1101"}})
+
+	message := <-subscription.Messages()
+	if message.ID != "2" {
+		t.Errorf("got change %s, want only the change to ITB/1101", message.ID)
+	}
+
+	//a subscriber that doesn't keep up is dropped
+	h.broadcast(Message{Type: ChangeMessage, ID: "3", Change: &store.HistoryRecord{Building: "ITB", Room: "1101"}})
+	h.broadcast(Message{Type: ChangeMessage, ID: "4", Change: &store.HistoryRecord{Building: "ITB", Room: "1101"}})
+
+	<-subscription.Messages()
+	if _, ok := <-subscription.Messages(); ok || !subscription.Slow() {
+		t.Errorf("a subscriber with a full buffer should be dropped as slow")
+	}
+	if h.Count() != 0 {
+		t.Errorf("got %d subscribers, want the slow one removed", h.Count())
+	}
+}
+
+//connects to an event stream, resuming after lastEventID
+func connect(t *testing.T, h *Hub, lastEventID string) (*sse.Decoder, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeEvents(h, nil, r.Header.Get("Last-Event-ID"), w, r)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req = req.WithContext(ctx)
+	req.Header.Set("Last-Event-ID", lastEventID)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sse.NewDecoder(resp.Body), func() {
+		cancel()
+		resp.Body.Close()
+		server.Close()
+	}
+}
+
+func TestServeEventsResume(t *testing.T) {
+	s := store.NewMemoryStore()
+	h := NewHub(s)
+
+	now := time.Now()
+	first := change(t, s, "ITB", "1101", now.Add(-3*time.Minute))
+	second := change(t, s, "ITB", "1108", now.Add(-2*time.Minute))
+	third := change(t, s, "ITB", "1101", now.Add(-1*time.Minute))
+
+	decoder, done := connect(t, h, first)
+	defer done()
+
+	for _, want := range []string{second, third} {
+		event, err := decoder.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != ChangeMessage || event.ID != want {
+			t.Fatalf("got %s %s, want change %s", event.Type, event.ID, want)
+		}
+	}
+
+	//a replayed change that also comes through the subscription isn't sent twice
+	fourth := store.FormatStamp(now)
+	h.broadcast(Message{Type: ChangeMessage, ID: second, Change: &store.HistoryRecord{Building: "ITB", Room: "1108"}})
+	h.broadcast(Message{Type: ChangeMessage, ID: fourth, Change: &store.HistoryRecord{Building: "ITB", Room: "1101"}})
+
+	event, err := decoder.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != fourth {
+		t.Errorf("got change %s, want %s", event.ID, fourth)
+	}
+}
+
+func TestServeEventsTooFarBehind(t *testing.T) {
+	s := store.NewMemoryStore()
+	h := NewHub(s)
+
+	change(t, s, "ITB", "1101", time.Now())
+
+	decoder, done := connect(t, h, store.FormatStamp(time.Now().Add(-ReplayMaxAge-time.Minute)))
+	defer done()
+
+	event, err := decoder.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != SnapshotMessage {
+		t.Errorf("got a %s, want a client that missed too much to be sent a snapshot", event.Type)
+	}
+}
@@ -0,0 +1,8 @@
+package stream
+
+import "github.com/byuoitav/monster-monitoring-service/metrics"
+
+var (
+	websocketSubscribers = metrics.NewGauge("monster_websocket_subscribers", "Open WebSocket connections streaming state changes.")
+	sseSubscribers       = metrics.NewGauge("monster_sse_subscribers", "Open server-sent event streams.")
+)
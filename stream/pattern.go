@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"path"
+	"strings"
+
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//matches building/room/device. each segment is a path.Match pattern, and missing segments match anything
+type Pattern [3]string
+
+func ParsePattern(s string) (Pattern, error) {
+
+	pattern := Pattern{"*", "*", "*"}
+
+	segments := strings.SplitN(strings.Trim(s, "/"), "/", 3)
+	for i, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+
+		_, err := path.Match(segment, "")
+		if err != nil {
+			return pattern, err
+		}
+		pattern[i] = segment
+	}
+
+	return pattern, nil
+}
+
+//room-wide records have no device, so they only match a pattern whose device segment matches anything
+func (p Pattern) Match(building, room, device string) bool {
+	return match(p[0], building) && match(p[1], room) && match(p[2], device)
+}
+
+func match(pattern, value string) bool {
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+//a set of patterns. an empty filter matches everything
+type Filter []Pattern
+
+func ParseFilter(patterns []string) (Filter, error) {
+
+	var filter Filter
+	for _, s := range patterns {
+		pattern, err := ParsePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, pattern)
+	}
+
+	return filter, nil
+}
+
+//the narrowest history prefix that holds everything the filter matches
+func (f Filter) prefix() []byte {
+
+	if len(f) != 1 {
+		return store.Prefix(store.HistoryClass)
+	}
+
+	var segments []string
+	for _, segment := range f[0][:2] {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		segments = append(segments, segment)
+	}
+
+	return store.Prefix(store.HistoryClass, segments...)
+}
+
+func (f Filter) Match(building, room, device string) bool {
+
+	if len(f) == 0 {
+		return true
+	}
+
+	for _, pattern := range f {
+		if pattern.Match(building, room, device) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/sse"
+)
+
+//streams the changes filter matches as server-sent events until the client goes away.
+//a client resuming after lastEventID is sent the changes it missed, unless it missed more than Replay allows; anyone else starts with a snapshot
+func ServeEvents(h *Hub, filter Filter, lastEventID string, w http.ResponseWriter, r *http.Request) error {
+
+	sseSubscribers.Add(1)
+	defer sseSubscribers.Add(-1)
+
+	//subscribe first so nothing stored while we replay is missed
+	subscription := h.Subscribe(filter)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := sse.NewEncoder(w)
+	write := func(message Message) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(sse.Event{ID: message.ID, Type: message.Type, Data: string(data)})
+	}
+
+	//changes stored while the replay is written are held here rather than left to fill the subscription. false if the subscription ended or too many piled up
+	var pending []Message
+	hold := func() bool {
+		for {
+			select {
+			case message, ok := <-subscription.Messages():
+				if !ok {
+					return false
+				}
+				if len(pending) == ReplayLimit {
+					log.Printf("Event stream %s fell %d changes behind while replaying. Dropping it", r.RemoteAddr, ReplayLimit)
+					return false
+				}
+				pending = append(pending, message)
+			default:
+				return true
+			}
+		}
+	}
+
+	//what the replay sent, so it isn't sent again when it comes through the subscription. the replay isn't in strict ID order across rooms, so this can't just be the last ID
+	replayed := make(map[string]bool)
+
+	resume := len(lastEventID) > 0
+	var missed []Message
+	if resume {
+		var err error
+		missed, err = h.Replay(filter, lastEventID)
+		if err == ErrReplayTooLong {
+			log.Printf("Event stream %s missed too much since %s to replay. Sending a snapshot", r.RemoteAddr, lastEventID)
+			resume = false
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if resume {
+		for _, message := range missed {
+			err := write(message)
+			if err != nil {
+				return err
+			}
+			replayed[message.ID] = true
+
+			if !hold() {
+				return nil
+			}
+		}
+	} else {
+		snapshot, err := h.Snapshot(filter)
+		if err != nil {
+			return err
+		}
+		err = write(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	send := func(message Message) error {
+		if replayed[message.ID] || (len(lastEventID) > 0 && message.ID <= lastEventID) {
+			return nil
+		}
+		return write(message)
+	}
+
+	for _, message := range pending {
+		err := send(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				return nil
+			}
+			err := send(message)
+			if err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			err := encoder.Comment("ping")
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package stream
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//how often idle connections are pinged, and how long a connection can go without answering before it's closed
+var (
+	PingInterval = 30 * time.Second
+	PongWait     = 60 * time.Second
+	WriteWait    = 10 * time.Second
+)
+
+//the largest request a client can send
+const maxRequestSize = 4096
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+
+	//the CORS middleware already lets any origin in
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+//what clients send to change their subscription. each one replaces the last and is answered with a new snapshot
+type request struct {
+	Subscribe []string `json:"subscribe"`
+}
+
+//upgrades the request to a WebSocket and streams the changes filter matches until the client goes away
+func ServeWebSocket(h *Hub, filter Filter, w http.ResponseWriter, r *http.Request) error {
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	websocketSubscribers.Add(1)
+	defer websocketSubscribers.Add(-1)
+
+	subscription := h.Subscribe(filter)
+	filters := make(chan Filter, 1)
+	filters <- filter
+
+	go readRequests(conn, filters)
+	writeMessages(h, conn, subscription, filters)
+
+	return nil
+}
+
+//the only goroutine that reads from conn. closes filters when the client goes away
+func readRequests(conn *websocket.Conn, filters chan Filter) {
+
+	defer close(filters)
+
+	conn.SetReadLimit(maxRequestSize)
+	conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
+
+	for {
+		var req request
+		err := conn.ReadJSON(&req)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Error reading from WebSocket %s: %s", conn.RemoteAddr(), err.Error())
+			}
+			return
+		}
+
+		filter, err := ParseFilter(req.Subscribe)
+		if err != nil {
+			log.Printf("Bad subscription from WebSocket %s: %s", conn.RemoteAddr(), err.Error())
+			continue
+		}
+
+		//only the latest request matters
+		select {
+		case <-filters:
+		default:
+		}
+		filters <- filter
+	}
+}
+
+//the only goroutine that writes to conn
+func writeMessages(h *Hub, conn *websocket.Conn, subscription *Subscription, filters chan Filter) {
+
+	ticker := time.NewTicker(PingInterval)
+	defer func() {
+		ticker.Stop()
+		subscription.Close()
+		conn.Close()
+	}()
+
+	write := func(message Message) bool {
+		conn.SetWriteDeadline(time.Now().Add(WriteWait))
+		return conn.WriteJSON(message) == nil
+	}
+
+	for {
+		select {
+		case filter, ok := <-filters:
+			if !ok {
+				return
+			}
+
+			subscription.SetFilter(filter)
+			snapshot, err := h.Snapshot(filter)
+			if err != nil {
+				log.Printf("Error building snapshot for WebSocket %s: %s", conn.RemoteAddr(), err.Error())
+				return
+			}
+			if !write(snapshot) {
+				return
+			}
+
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				reason := "server shutting down"
+				code := websocket.CloseGoingAway
+				if subscription.Slow() {
+					log.Printf("WebSocket %s is too slow. Disconnecting it", conn.RemoteAddr())
+					reason = "too slow"
+					code = websocket.ClosePolicyViolation
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(WriteWait))
+				return
+			}
+			if !write(message) {
+				return
+			}
+
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WriteWait))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+//keeps fleet-wide and per-building rollups up to date as events come through the pipeline
+package summary
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/alerts"
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//how many reconcile passes a room can go without an event before it counts as stale. the reconciler marks every room it can poll as verified every
+//store.ReconcileInterval, so only rooms that can't be polled go stale
+var StalePasses = 2
+
+func staleAfter() time.Duration {
+	return time.Duration(StalePasses) * store.ReconcileInterval
+}
+
+//counts for the whole fleet, or one building
+type Summary struct {
+	Building        string `json:"building,omitempty"`
+	Rooms           int    `json:"rooms"`
+	RoomsPoweredOn  int    `json:"roomsPoweredOn"`
+	DisplaysBlanked int    `json:"displaysBlanked"`
+	DevicesOffline  int    `json:"devicesOffline"`
+	ActiveAlerts    int    `json:"activeAlerts"`
+	StaleRooms      int    `json:"staleRooms"`
+}
+
+type Rollup struct {
+	Fleet     Summary   `json:"fleet"`
+	Buildings []Summary `json:"buildings"`
+}
+
+//what the tracker knows about one room
+type room struct {
+	poweredOn bool
+	updated   time.Time
+	blanked   map[string]bool //by display
+	offline   map[string]bool //by device
+}
+
+func newRoom() *room {
+	return &room{
+		blanked: make(map[string]bool),
+		offline: make(map[string]bool),
+	}
+}
+
+//the pipeline stage. Seed it from the store before events start flowing
+type Tracker struct {
+	alerts *alerts.Manager
+
+	//the pipeline's store stage runs first, so records here are up to date with the event being handled
+	store store.Store
+
+	mutex sync.RWMutex
+	rooms map[store.RoomID]*room
+}
+
+func NewTracker(m *alerts.Manager, s store.Store) *Tracker {
+	return &Tracker{
+		alerts: m,
+		store:  s,
+		rooms:  make(map[store.RoomID]*room),
+	}
+}
+
+//loads what the store already knows, so the counts are right before every room has been heard from again
+func (t *Tracker) Seed() error {
+
+	rooms, err := store.ListRooms(t.store, "")
+	if err != nil {
+		return err
+	}
+
+	devices, err := store.ListDevices(t.store, "", "")
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, record := range rooms {
+		r := t.room(store.RoomID{Building: record.Room.Building, Room: record.Room.Room})
+		r.poweredOn = strings.EqualFold(record.Room.Power, "on")
+		r.updated = record.Updated
+
+		for _, display := range record.Room.Displays {
+			r.blanked[display.Name] = display.Blanked != nil && *display.Blanked
+		}
+	}
+
+	for _, device := range devices {
+		if device.Offline() {
+			t.room(store.RoomID{Building: device.Building, Room: device.Room}).offline[device.Device] = true
+		}
+	}
+
+	return nil
+}
+
+func (t *Tracker) Handle(event pipeline.Event) error {
+
+	id := store.RoomID{Building: event.Building, Room: event.Room}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if event.Key == pipeline.KeyInventory {
+		switch event.Value {
+		//rooms only the inventory knows about still count, and go stale if nothing is ever heard from them
+		case store.RoomAdded, store.RoomKnown, store.DeviceAdded, store.DeviceKnown:
+			if _, ok := t.rooms[id]; !ok {
+				t.room(id).updated = time.Now()
+			}
+		case store.RoomRemoved:
+			delete(t.rooms, id)
+		case store.DeviceRemoved:
+			if r, ok := t.rooms[id]; ok {
+				delete(r.blanked, event.Device)
+				delete(r.offline, event.Device)
+			}
+		}
+		return nil
+	}
+
+	if event.IsNotice() {
+		return nil
+	}
+
+	r := t.room(id)
+	r.updated = time.Now()
+
+	switch {
+	case event.Key == pipeline.KeyPower && len(event.Device) == 0:
+		r.poweredOn = strings.EqualFold(event.Value, "on")
+	case event.Key == pipeline.KeyBlanked && len(event.Device) > 0:
+		r.blanked[event.Device] = event.Value == "true"
+	case event.Key == pipeline.KeyRole && len(event.Value) == 0:
+		delete(r.blanked, event.Device)
+	//counted the same way as the offline room filter, so a device is only offline once salt knows its minion
+	case (event.Key == pipeline.KeyOnline || event.Key == pipeline.KeyMinion) && len(event.Device) > 0:
+		device, err := store.GetDevice(t.store, event.Building, event.Room, event.Device)
+		if err != nil {
+			return err
+		}
+		r.offline[event.Device] = device.Offline()
+	}
+
+	return nil
+}
+
+//must hold t.mutex
+func (t *Tracker) room(id store.RoomID) *room {
+	r, ok := t.rooms[id]
+	if !ok {
+		r = newRoom()
+		t.rooms[id] = r
+	}
+	return r
+}
+
+//the fleet's counts, and each building's, by building name
+func (t *Tracker) Rollup() Rollup {
+
+	now := time.Now()
+	buildings := make(map[string]*Summary)
+
+	building := func(name string) *Summary {
+		summary, ok := buildings[name]
+		if !ok {
+			summary = &Summary{Building: name}
+			buildings[name] = summary
+		}
+		return summary
+	}
+
+	t.mutex.RLock()
+	for id, r := range t.rooms {
+		summary := building(id.Building)
+		summary.Rooms++
+		if r.poweredOn {
+			summary.RoomsPoweredOn++
+		}
+		if now.Sub(r.updated) >= staleAfter() {
+			summary.StaleRooms++
+		}
+		summary.DisplaysBlanked += count(r.blanked)
+		summary.DevicesOffline += count(r.offline)
+	}
+	t.mutex.RUnlock()
+
+	if t.alerts != nil {
+		for _, alert := range t.alerts.Active() {
+			building(alert.Building).ActiveAlerts++
+		}
+	}
+
+	rollup := Rollup{Buildings: []Summary{}}
+	for _, summary := range buildings {
+		rollup.Buildings = append(rollup.Buildings, *summary)
+
+		rollup.Fleet.Rooms += summary.Rooms
+		rollup.Fleet.RoomsPoweredOn += summary.RoomsPoweredOn
+		rollup.Fleet.DisplaysBlanked += summary.DisplaysBlanked
+		rollup.Fleet.DevicesOffline += summary.DevicesOffline
+		rollup.Fleet.ActiveAlerts += summary.ActiveAlerts
+		rollup.Fleet.StaleRooms += summary.StaleRooms
+	}
+
+	sort.Slice(rollup.Buildings, func(i, j int) bool {
+		return rollup.Buildings[i].Building < rollup.Buildings[j].Building
+	})
+
+	return rollup
+}
+
+func count(flags map[string]bool) int {
+	n := 0
+	for _, flag := range flags {
+		if flag {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,120 @@
+package summary
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/pipeline"
+	"github.com/byuoitav/monster-monitoring-service/store"
+)
+
+//stores every event and then hands it to the tracker, like the pipeline does
+func handle(t *testing.T, s store.Store, tracker *Tracker, events ...pipeline.Event) {
+	for _, event := range events {
+		err := store.Apply(s, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tracker.Handle(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func event(room, device, key, value string) pipeline.Event {
+	return pipeline.Event{
+		Source:    pipeline.SourceSalt,
+		Timestamp: time.Now(),
+		Building:  "ITB",
+		Room:      room,
+		Device:    device,
+		Key:       key,
+		Value:     value,
+	}
+}
+
+func notice(room, kind string) pipeline.Event {
+	return pipeline.Event{
+		Source:    pipeline.SourceInventory,
+		Timestamp: time.Now(),
+		Building:  "ITB",
+		Room:      room,
+		Key:       pipeline.KeyInventory,
+		Value:     kind,
+	}
+}
+
+func TestStaleRooms(t *testing.T) {
+	interval := store.ReconcileInterval
+	store.ReconcileInterval = 50 * time.Millisecond
+	defer func() { store.ReconcileInterval = interval }()
+
+	s := store.NewMemoryStore()
+	tracker := NewTracker(nil, s)
+
+	//1101 is heard from, 1108 only comes from the inventory
+	handle(t, s, tracker, event("1101", "", pipeline.KeyPower, "on"), notice("1108", store.RoomKnown))
+
+	rollup := tracker.Rollup()
+	if rollup.Fleet.Rooms != 2 || rollup.Fleet.StaleRooms != 0 {
+		t.Fatalf("got %+v, want 2 rooms and none stale", rollup.Fleet)
+	}
+
+	//a room is stale once it's missed two reconcile passes
+	time.Sleep(store.ReconcileInterval)
+	handle(t, s, tracker, event("1101", "", pipeline.KeyPower, "on"))
+	if stale := tracker.Rollup().Fleet.StaleRooms; stale != 0 {
+		t.Errorf("got %d stale rooms after one pass, want none", stale)
+	}
+
+	time.Sleep(store.ReconcileInterval + 10*time.Millisecond)
+	rollup = tracker.Rollup()
+	if rollup.Fleet.StaleRooms != 1 {
+		t.Errorf("got %d stale rooms, want just 1108", rollup.Fleet.StaleRooms)
+	}
+
+	//and counts once it's heard from again
+	handle(t, s, tracker, event("1108", "", pipeline.KeyPower, "standby"))
+	if stale := tracker.Rollup().Fleet.StaleRooms; stale != 0 {
+		t.Errorf("got %d stale rooms after hearing from 1108, want none", stale)
+	}
+}
+
+func TestRoomRemoved(t *testing.T) {
+	s := store.NewMemoryStore()
+	tracker := NewTracker(nil, s)
+
+	handle(t, s, tracker, notice("1101", store.RoomAdded))
+	handle(t, s, tracker, notice("1101", store.RoomRemoved))
+
+	if rooms := tracker.Rollup().Fleet.Rooms; rooms != 0 {
+		t.Errorf("got %d rooms, want a removed room to stop counting", rooms)
+	}
+}
+
+func TestDevicesOffline(t *testing.T) {
+	s := store.NewMemoryStore()
+	tracker := NewTracker(nil, s)
+
+	//not offline as far as the offline filter is concerned until its minion is known
+	handle(t, s, tracker, event("1101", "CP1", pipeline.KeyOnline, "false"))
+	if offline := tracker.Rollup().Fleet.DevicesOffline; offline != 0 {
+		t.Errorf("got %d devices offline, want none without a minion", offline)
+	}
+
+	handle(t, s, tracker, event("1101", "CP1", pipeline.KeyMinion, "ITB-1101-CP1"))
+	if offline := tracker.Rollup().Fleet.DevicesOffline; offline != 1 {
+		t.Errorf("got %d devices offline, want 1", offline)
+	}
+
+	//and the same count comes back from the store after a restart
+	seeded := NewTracker(nil, s)
+	err := seeded.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offline := seeded.Rollup().Fleet.DevicesOffline; offline != 1 {
+		t.Errorf("got %d devices offline after seeding, want 1", offline)
+	}
+}
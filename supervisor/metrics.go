@@ -0,0 +1,5 @@
+package supervisor
+
+import "github.com/byuoitav/monster-monitoring-service/metrics"
+
+var restarts = metrics.NewCounter("monster_worker_restarts_total", "Times a worker panicked or failed and was restarted.", "worker")
@@ -0,0 +1,194 @@
+//runs the service's long-lived workers, restarting any that panic or fail until they're told to stop
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/monster-monitoring-service/backoff"
+	"github.com/byuoitav/monster-monitoring-service/readiness"
+)
+
+//bounds on how long to wait before restarting a failed worker
+var MinBackoff = 1 * time.Second
+var MaxBackoff = 1 * time.Minute
+
+//a worker that stays up this long has recovered, so its next failure is restarted after MinBackoff again
+var StableAfter = 5 * time.Minute
+
+//runs until ctx is canceled. returning nil before then means the worker is finished, an error means it should be restarted
+type Worker func(ctx context.Context) error
+
+type State string
+
+const (
+	Running    State = "running"
+	Restarting State = "restarting"
+	Finished   State = "finished"
+	Stopped    State = "stopped"
+)
+
+//a snapshot of one worker
+type Status struct {
+	Name        string     `json:"name"`
+	State       State      `json:"state"`
+	Started     time.Time  `json:"started"`
+	Restarts    int        `json:"restarts"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+}
+
+type Supervisor struct {
+	mutex   sync.RWMutex
+	workers map[string]*Status
+	running sync.WaitGroup
+}
+
+func New() *Supervisor {
+	return &Supervisor{workers: make(map[string]*Status)}
+}
+
+//starts a worker under name and registers it as a readiness check that fails while it's restarting. names must be unique
+func (s *Supervisor) Go(ctx context.Context, name string, worker Worker) {
+
+	s.mutex.Lock()
+	if _, ok := s.workers[name]; ok {
+		s.mutex.Unlock()
+		panic("worker " + name + " started twice")
+	}
+	s.workers[name] = &Status{Name: name, State: Running, Started: time.Now()}
+	s.mutex.Unlock()
+
+	readiness.Register("worker "+name, func() (time.Time, error) {
+		return s.ready(name)
+	})
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.supervise(ctx, name, worker)
+	}()
+}
+
+//blocks until every worker has stopped
+func (s *Supervisor) Wait() {
+	s.running.Wait()
+}
+
+//every worker, by name
+func (s *Supervisor) Status() []Status {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	toReturn := []Status{}
+	for _, status := range s.workers {
+		toReturn = append(toReturn, *status)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].Name < toReturn[j].Name
+	})
+	return toReturn
+}
+
+func (s *Supervisor) supervise(ctx context.Context, name string, worker Worker) {
+
+	retry := backoff.New(MinBackoff, MaxBackoff)
+
+	for {
+		started := time.Now()
+		s.update(name, func(status *Status) {
+			status.State = Running
+			status.Started = started
+		})
+
+		err := run(ctx, worker)
+
+		if ctx.Err() != nil {
+			s.update(name, func(status *Status) { status.State = Stopped })
+			return
+		}
+		if err == nil {
+			log.Printf("Worker %s finished", name)
+			s.update(name, func(status *Status) { status.State = Finished })
+			return
+		}
+
+		if time.Since(started) >= StableAfter {
+			retry.Reset()
+		}
+		wait := retry.Next()
+
+		now := time.Now()
+		s.update(name, func(status *Status) {
+			status.State = Restarting
+			status.Restarts++
+			status.LastError = err.Error()
+			status.LastFailure = &now
+		})
+		restarts.Inc(name)
+
+		log.Printf("Worker %s failed: %s. Restarting in %s (attempt %d)...", name, err.Error(), wait, retry.Attempt())
+
+		select {
+		case <-ctx.Done():
+			s.update(name, func(status *Status) { status.State = Stopped })
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+//runs the worker once, turning a panic into an error
+func run(ctx context.Context, worker Worker) error {
+	return Recover(func() error {
+		return worker(ctx)
+	})
+}
+
+//what Recover returns when fn panics
+type PanicError struct {
+	Value interface{}
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+//calls fn, turning a panic into a *PanicError. goroutines a worker starts should run under it and hand the error back,
+//since the supervisor can only recover panics in the worker's own goroutine
+func Recover(fn func() error) (err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic: %v\n%s", r, debug.Stack())
+			err = &PanicError{Value: r}
+		}
+	}()
+
+	return fn()
+}
+
+func (s *Supervisor) update(name string, fn func(*Status)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fn(s.workers[name])
+}
+
+//for the readiness check: fails while the worker is waiting to be restarted
+func (s *Supervisor) ready(name string) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	status := s.workers[name]
+	if status.State != Restarting {
+		return time.Time{}, nil
+	}
+	return status.Started, fmt.Errorf("restarting after failing %d times: %s", status.Restarts, status.LastError)
+}
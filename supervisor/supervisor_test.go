@@ -0,0 +1,175 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+//shortens the backoff for a test
+func fast() func() {
+	min, max, stable := MinBackoff, MaxBackoff, StableAfter
+	MinBackoff, MaxBackoff, StableAfter = 20*time.Millisecond, 80*time.Millisecond, time.Hour
+
+	return func() {
+		MinBackoff, MaxBackoff, StableAfter = min, max, stable
+	}
+}
+
+//records when each run of a worker started and ended
+type runs struct {
+	mutex  sync.Mutex
+	starts []time.Time
+	ends   []time.Time
+}
+
+func (r *runs) start() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.starts = append(r.starts, time.Now())
+	return len(r.starts)
+}
+
+func (r *runs) end() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ends = append(r.ends, time.Now())
+}
+
+func status(s *Supervisor, name string) Status {
+	for _, status := range s.Status() {
+		if status.Name == name {
+			return status
+		}
+	}
+	return Status{}
+}
+
+func TestRestart(t *testing.T) {
+	defer fast()()
+
+	s := New()
+
+	//panics, fails, then finishes
+	var r runs
+	s.Go(context.Background(), "restart", func(ctx context.Context) error {
+		switch r.start() {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("failed")
+		}
+		return nil
+	})
+	s.Wait()
+
+	if len(r.starts) != 3 {
+		t.Fatalf("worker ran %d times, want 3", len(r.starts))
+	}
+
+	got := status(s, "restart")
+	if got.State != Finished || got.Restarts != 2 || got.LastError != "failed" || got.LastFailure == nil {
+		t.Errorf("got status %+v, want finished after 2 restarts", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer fast()()
+
+	s := New()
+
+	var r runs
+	s.Go(context.Background(), "backoff", func(ctx context.Context) error {
+		if r.start() == 5 {
+			return nil
+		}
+		return errors.New("failed")
+	})
+	s.Wait()
+
+	//jitter takes up to half off each wait: 10-20ms, 20-40ms, 40-80ms, then capped at 40-80ms
+	bounds := [][2]time.Duration{{10, 20}, {20, 40}, {40, 80}, {40, 80}}
+	for i, bound := range bounds {
+		gap := r.starts[i+1].Sub(r.starts[i])
+		low, high := bound[0]*time.Millisecond, bound[1]*time.Millisecond
+		if gap < low || gap > high+20*time.Millisecond {
+			t.Errorf("restart %d came after %s, want between %s and %s", i+1, gap, low, high)
+		}
+	}
+}
+
+func TestBackoffResetsWhenStable(t *testing.T) {
+	defer fast()()
+	StableAfter = 50 * time.Millisecond
+
+	s := New()
+
+	//fails right away a few times, then stays up long enough to count as recovered before failing again
+	var r runs
+	s.Go(context.Background(), "stable", func(ctx context.Context) error {
+		defer r.end()
+
+		switch r.start() {
+		case 4:
+			time.Sleep(StableAfter)
+		case 5:
+			return nil
+		}
+		return errors.New("failed")
+	})
+	s.Wait()
+
+	gap := r.starts[4].Sub(r.ends[3])
+	if gap > MinBackoff+20*time.Millisecond {
+		t.Errorf("restart after a stable run came after %s, want no more than %s", gap, MinBackoff)
+	}
+}
+
+func TestStop(t *testing.T) {
+	defer fast()()
+	MinBackoff, MaxBackoff = time.Hour, time.Hour
+
+	s := New()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	failed := make(chan struct{})
+	s.Go(ctx, "stop", func(ctx context.Context) error {
+		close(failed)
+		return errors.New("failed")
+	})
+
+	<-failed
+	for status(s, "stop").State != Restarting {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := s.ready("stop"); err == nil {
+		t.Errorf("a restarting worker should fail its readiness check")
+	}
+
+	//canceling stops a worker waiting to be restarted
+	cancel()
+	s.Wait()
+
+	if got := status(s, "stop").State; got != Stopped {
+		t.Errorf("got state %s, want stopped", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	err := Recover(func() error {
+		panic("boom")
+	})
+
+	panicked, ok := err.(*PanicError)
+	if !ok || panicked.Value != "boom" {
+		t.Errorf("got %v, want a *PanicError for boom", err)
+	}
+
+	if err := Recover(func() error { return nil }); err != nil {
+		t.Errorf("got %v from a func that didn't panic", err)
+	}
+}